@@ -1,159 +1,277 @@
 package chess
 
 import (
+	"context"
 	"math"
 	"sort"
 )
 
-// TranspositionEntry represents an entry in the transposition table
-type TranspositionEntry struct {
-	depth int
-	score float64
-	flag  int // 0 = exact, 1 = lower bound, 2 = upper bound
+// mateScore is the score for checkmating the opponent at the root. Mates
+// further away score one less per ply, so the search prefers the quickest.
+const mateScore = 1000.0
+
+// nullWindow is the width of the window that only tests whether a move
+// scores above alpha, a fraction of the smallest difference in evaluation
+const nullWindow = 0.0001
+
+// pieceValues holds the material value of each piece type in pawns
+var pieceValues = [...]float64{
+	Pawn:   1.0,
+	Knight: 3.2,
+	Bishop: 3.3,
+	Rook:   5.0,
+	Queen:  9.0,
+	King:   0.0,
 }
 
 // AI represents the computer player
 type AI struct {
 	color              Color
 	depth              int
-	transpositionTable map[uint64]TranspositionEntry
-	killerMoves        [10][2]Move // killer moves for each depth
+	transpositionTable *TranspositionTable // shared with the helpers of a parallel search
+	killerMoves        [10][2]Move         // killer moves for each depth
 	historyTable       map[Move]int
+	nodes              uint64 // positions visited by the last search
+	done               <-chan struct{}
+	nodeLimit          uint64
+	stopped            bool
+	onIteration        func(SearchResult)
+	pvTable            [MaxSearchDepth + 1][MaxSearchDepth + 1]Move // best line from each ply
+	pvLength           [MaxSearchDepth + 1]int                      // where each line in pvTable ends
+	pv                 []Move                                       // principal variation of the last iteration
+	nullMove           [MaxSearchDepth + 1]bool                     // plies where a null move is being searched
+	options            SearchOptions
+	threads            int
+	multiPV            int
+	excluded           []Move        // root moves that already start a line of a MultiPV search
+	rootPosition       int           // index of the root in the game's position history
+	shared             *sharedSearch // state of a parallel search, nil with one thread
+	published          uint64        // nodes a helper has added to the shared count
 }
 
 // NewAI creates a new AI player
 func NewAI(color Color, depth int) *AI {
 	return &AI{
-		color:              color,
-		depth:              depth,
-		transpositionTable: make(map[uint64]TranspositionEntry),
-		historyTable:       make(map[Move]int),
+		color:        color,
+		depth:        depth,
+		historyTable: make(map[Move]int),
+		options:      DefaultSearchOptions(),
+		threads:      1,
 	}
 }
 
-// GetBestMove returns the best move for the AI player using iterative deepening
+// GetBestMove returns the squares of the best move for the AI player.
+// Use BestMove to also learn the promotion choice.
 func (ai *AI) GetBestMove(game *Game) (from Position, to Position, found bool) {
-	if game.CurrentPlayer != ai.color {
-		return Position{}, Position{}, false
-	}
-
-	allMoves := ai.getAllPossibleMoves(game)
-	if len(allMoves) == 0 {
-		return Position{}, Position{}, false
-	}
+	move, found := ai.BestMove(game)
+	return move.From, move.To, found
+}
 
-	// Clear killer moves for new search
-	ai.killerMoves = [10][2]Move{}
+// BestMove returns the best move for the AI player, searching to the AI's depth
+func (ai *AI) BestMove(game *Game) (Move, bool) {
+	result, ok := ai.Search(context.Background(), game, Limits{Depth: ai.depth})
+	return result.Move, ok
+}
 
-	var bestMove Move
-	bestScore := math.Inf(-1)
+// SetTranspositionTable makes the AI use the table, for example to choose its
+// size or to keep it between AIs that play the same game. By default an AI
+// creates a table of DefaultHashSize MB on its first search.
+func (ai *AI) SetTranspositionTable(table *TranspositionTable) {
+	ai.transpositionTable = table
+}
 
-	// Iterative deepening - start with depth 1 and increase
-	for currentDepth := 1; currentDepth <= ai.depth; currentDepth++ {
-		tempBestMove := Move{}
-		tempBestScore := math.Inf(-1)
+// TranspositionTable returns the table the AI uses, or nil before its first search
+func (ai *AI) TranspositionTable() *TranspositionTable {
+	return ai.transpositionTable
+}
 
-		// Order moves for better alpha-beta pruning
-		orderedMoves := ai.orderMoves(allMoves, game, 0)
+// Nodes returns the number of positions visited by the last search
+func (ai *AI) Nodes() uint64 {
+	return ai.nodes
+}
 
-		for _, move := range orderedMoves {
-			gameCopy := ai.copyGame(game)
-			err := gameCopy.MakeMove(move.From.String(), move.To.String())
-			if err != nil {
-				continue
-			}
+// AcceptsDraw reports whether the AI agrees to a draw in the current position,
+// which it does unless it evaluates the position as better for itself
+func (ai *AI) AcceptsDraw(game *Game) bool {
+	return ai.evaluatePosition(game) <= 0
+}
 
-			score := ai.minimax(gameCopy, currentDepth-1, false, math.Inf(-1), math.Inf(1), 1)
+// negamax searches the position to the given depth with alpha-beta pruning
+// and returns its score for the side to move. It is a principal variation
+// search: the first move, expected to be best, is searched with the full
+// window and the rest only with a null window proving them no better, unless
+// that fails. The best line found is collected in the PV table. Away from the
+// principal variation, which the caller marks with pvNode, the selective
+// techniques enabled in the AI's options prune or reduce moves unlikely to
+// matter. Moves are made and taken back on the game in place, which is left
+// unchanged on return.
+func (ai *AI) negamax(game *Game, depth int, alpha, beta float64, ply int, pvNode bool) float64 {
+	ai.pvLength[ply] = ply
+
+	// Positions in check are searched one ply deeper, which also keeps the
+	// search from standing pat in check at the horizon
+	inCheck := game.State == Check
+	if inCheck && ply > 0 && ai.options.CheckExtensions {
+		depth++
+	}
+
+	// Leaves are resolved by quiescence search, whose score depends on the
+	// window and is not stored
+	if depth <= 0 || ply >= MaxSearchDepth {
+		return ai.quiescence(game, alpha, beta, ply)
+	}
+
+	ai.nodes++
+	if ai.shouldStop() {
+		return 0
+	}
+
+	// The root always searches its moves to find one to play
+	hash := game.Hash()
+	entry, found := ai.transpositionTable.probe(hash)
+	if ply > 0 {
+		if game.State == Checkmate {
+			// Prefer shorter mates
+			return -mateScore + float64(ply)
+		}
+		if game.IsGameOver() {
+			return 0
+		}
+		// A line that returns to a position of the search could repeat it
+		// for ever, and a threefold repetition or fifty moves without
+		// progress could be claimed, so all of them score as draws
+		if game.HalfmoveClock >= 100 || game.repeats(ai.rootPosition) {
+			return 0
+		}
 
-			if score > tempBestScore {
-				tempBestScore = score
-				tempBestMove = move
+		// Nodes on the principal variation take no cutoffs from the table,
+		// which would cut the variation short
+		if found && entry.depth >= depth && !pvNode {
+			score := scoreFromTable(entry.score, ply)
+			switch entry.flag {
+			case 0: // exact
+				return score
+			case 1: // lower bound
+				alpha = math.Max(alpha, score)
+			case 2: // upper bound
+				beta = math.Min(beta, score)
+			}
+			if alpha >= beta {
+				return score
 			}
 		}
+	}
 
-		// Update best move if we found a better one
-		if tempBestScore > bestScore {
-			bestScore = tempBestScore
-			bestMove = tempBestMove
-		}
+	// Selective pruning is only safe away from the principal variation, out
+	// of check and without a mate in the window
+	selective := ply > 0 && !pvNode && !inCheck && math.Abs(beta) < mateScore-MaxSearchDepth
+	staticEval := 0.0
+	if selective {
+		staticEval = ai.evaluate(game)
 	}
 
-	return bestMove.From, bestMove.To, true
-}
+	// Reverse futility pruning: a position this far above beta near the
+	// leaves is not expected to fall below it
+	if selective && ai.options.ReverseFutility && depth <= futilityDepth &&
+		staticEval-futilityMargin*float64(depth) >= beta {
+		return staticEval
+	}
 
-// minimax implements the minimax algorithm with alpha-beta pruning and optimizations
-func (ai *AI) minimax(game *Game, depth int, isMaximizing bool, alpha, beta float64, ply int) float64 {
-	// Check transposition table
-	hash := ai.hashPosition(game)
-	if entry, exists := ai.transpositionTable[hash]; exists && entry.depth >= depth {
-		switch entry.flag {
-		case 0: // exact
-			return entry.score
-		case 1: // lower bound
-			alpha = math.Max(alpha, entry.score)
-		case 2: // upper bound
-			beta = math.Min(beta, entry.score)
+	// Null-move pruning: if passing still fails high, a real move will too.
+	// Two null moves in a row would prove nothing.
+	if selective && ai.options.NullMove && depth >= nullMoveMinDepth && staticEval >= beta &&
+		!ai.nullMove[ply-1] && hasPieces(game, game.CurrentPlayer) {
+		reduction := 2
+		if depth > 6 {
+			reduction = 3
 		}
-		if alpha >= beta {
-			return entry.score
+
+		enPassantTarget := game.makeNullMove()
+		ai.nullMove[ply] = true
+		score := -ai.negamax(game, depth-1-reduction, -beta, -beta+nullWindow, ply+1, false)
+		ai.nullMove[ply] = false
+		game.unmakeNullMove(enPassantTarget)
+		if ai.stopped {
+			return 0
 		}
-	}
 
-	if depth == 0 || game.State != Playing {
-		score := ai.evaluatePosition(game)
-		// Store in transposition table
-		ai.transpositionTable[hash] = TranspositionEntry{
-			depth: depth,
-			score: score,
-			flag:  0, // exact
+		if score >= beta {
+			// A mate found after passing is not a real one
+			return math.Min(score, mateScore-MaxSearchDepth)
 		}
-		return score
 	}
 
+	// Futility pruning: near the leaves, quiet moves cannot lift a position
+	// this far below alpha
+	futile := selective && ai.options.Futility && depth <= futilityDepth &&
+		staticEval+futilityMargin*float64(depth) <= alpha
+
 	moves := ai.getAllPossibleMoves(game)
+	if ply == 0 {
+		moves = ai.withoutExcluded(moves)
+	}
 	if len(moves) == 0 {
-		if ai.isInCheck(game, game.CurrentPlayer) {
-			// Checkmate - prefer shorter mates
-			if isMaximizing {
-				return -1000.0 + float64(ply)
-			}
-			return 1000.0 - float64(ply)
+		// Only after a null move is the game state not up to date
+		if inCheck {
+			return -mateScore + float64(ply)
 		}
-		return 0.0 // Stalemate
+		return 0
 	}
 
-	// Order moves for better pruning
-	orderedMoves := ai.orderMoves(moves, game, ply)
+	// Order moves for better pruning, starting with the best move the
+	// table knows for the position
+	orderedMoves := ai.orderMoves(moves, game, ply, entry.move)
 
 	originalAlpha := alpha
 	bestScore := math.Inf(-1)
-	if !isMaximizing {
-		bestScore = math.Inf(1)
-	}
+	var bestMove Move
+
+	for i, move := range orderedMoves {
+		quiet := !ai.isCapture(move, game) && move.Promotion == NoPromotion
+		killer := ai.isKiller(move, ply)
+		game.makeMove(move)
+		givesCheck := game.State == Check || game.State == Checkmate
 
-	for _, move := range orderedMoves {
-		gameCopy := ai.copyGame(game)
-		err := gameCopy.MakeMove(move.From.String(), move.To.String())
-		if err != nil {
+		if futile && i > 0 && quiet && !givesCheck {
+			game.unmakeLastMove()
 			continue
 		}
 
 		var score float64
-		if isMaximizing {
-			score = ai.minimax(gameCopy, depth-1, false, alpha, beta, ply+1)
-			if score > bestScore {
-				bestScore = score
-			}
-			alpha = math.Max(alpha, score)
+		if i == 0 {
+			score = -ai.negamax(game, depth-1, -beta, -alpha, ply+1, pvNode)
 		} else {
-			score = ai.minimax(gameCopy, depth-1, true, alpha, beta, ply+1)
-			if score < bestScore {
-				bestScore = score
+			// Late quiet moves are searched less deep first
+			reduction := 0
+			if ai.options.LateMoveReductions && quiet && !killer && !inCheck && !givesCheck {
+				reduction = lateMoveReduction(depth, i)
 			}
-			beta = math.Min(beta, score)
+
+			score = -ai.negamax(game, depth-1-reduction, -alpha-nullWindow, -alpha, ply+1, false)
+			if score > alpha && reduction > 0 {
+				score = -ai.negamax(game, depth-1, -alpha-nullWindow, -alpha, ply+1, false)
+			}
+			if pvNode && score > alpha && score < beta {
+				// The move may be better after all, so search it properly
+				score = -ai.negamax(game, depth-1, -beta, -alpha, ply+1, true)
+			}
+		}
+		game.unmakeLastMove()
+		if ai.stopped {
+			// The score of an interrupted search means nothing
+			return 0
+		}
+
+		if score > bestScore {
+			bestScore = score
+		}
+		if score > alpha {
+			alpha = score
+			bestMove = move
+			ai.updatePV(ply, move)
 		}
 
-		if beta <= alpha {
+		if alpha >= beta {
 			// Store killer move
 			if ply < 10 && !ai.isCapture(move, game) {
 				ai.killerMoves[ply][1] = ai.killerMoves[ply][0]
@@ -165,6 +283,11 @@ func (ai *AI) minimax(game *Game, depth int, isMaximizing bool, alpha, beta floa
 		}
 	}
 
+	// A root searched without some of its moves has no score of its own
+	if ply == 0 && len(ai.excluded) > 0 {
+		return bestScore
+	}
+
 	// Store in transposition table
 	flag := 0 // exact
 	if bestScore <= originalAlpha {
@@ -173,17 +296,23 @@ func (ai *AI) minimax(game *Game, depth int, isMaximizing bool, alpha, beta floa
 		flag = 1 // lower bound
 	}
 
-	ai.transpositionTable[hash] = TranspositionEntry{
+	ai.transpositionTable.store(hash, TranspositionEntry{
 		depth: depth,
-		score: bestScore,
+		score: scoreToTable(bestScore, ply),
 		flag:  flag,
-	}
+		move:  bestMove,
+	})
 
 	return bestScore
 }
 
+// isKiller reports whether the move is a killer move at the given ply
+func (ai *AI) isKiller(move Move, ply int) bool {
+	return ply < 10 && (move == ai.killerMoves[ply][0] || move == ai.killerMoves[ply][1])
+}
+
 // orderMoves orders moves for better alpha-beta pruning
-func (ai *AI) orderMoves(moves []Move, game *Game, ply int) []Move {
+func (ai *AI) orderMoves(moves []Move, game *Game, ply int, hashMove Move) []Move {
 	type scoredMove struct {
 		move  Move
 		score int
@@ -203,6 +332,20 @@ func (ai *AI) orderMoves(moves []Move, game *Game, ply int) []Move {
 			}
 		}
 
+		// Prioritize promotions, queen first
+		if move.Promotion != NoPromotion {
+			score += ai.getPieceValue(move.Promotion) * 10
+		}
+
+		// The best move from the transposition table comes first, then the
+		// principal variation of the previous iteration
+		if move == hashMove {
+			score += 20000
+		}
+		if ply < len(ai.pv) && move == ai.pv[ply] {
+			score += 10000
+		}
+
 		// Prioritize killer moves
 		if ply < 10 {
 			if move == ai.killerMoves[ply][0] {
@@ -248,31 +391,29 @@ func (ai *AI) orderMoves(moves []Move, game *Game, ply int) []Move {
 	return result
 }
 
+// evaluate returns the static evaluation of the position for the side to move
+func (ai *AI) evaluate(game *Game) float64 {
+	if game.CurrentPlayer != ai.color {
+		return -ai.evaluatePosition(game)
+	}
+	return ai.evaluatePosition(game)
+}
+
 // evaluatePosition evaluates the current position and returns a score (enhanced)
 func (ai *AI) evaluatePosition(game *Game) float64 {
 	if game.State == Checkmate {
 		if game.CurrentPlayer == ai.color {
-			return -1000.0 // AI is checkmated
+			return -mateScore // AI is checkmated
 		}
-		return 1000.0 // Opponent is checkmated
+		return mateScore // Opponent is checkmated
 	}
 
-	if game.State == Stalemate {
+	if game.State == Stalemate || game.State == Draw {
 		return 0.0 // Draw
 	}
 
 	score := 0.0
 
-	// Enhanced piece values
-	pieceValues := map[PieceType]float64{
-		Pawn:   1.0,
-		Knight: 3.2,
-		Bishop: 3.3,
-		Rook:   5.0,
-		Queen:  9.0,
-		King:   0.0,
-	}
-
 	// Enhanced position tables
 	pawnTable := [8][8]float64{
 		{0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0},
@@ -410,8 +551,8 @@ func (ai *AI) evaluatePosition(game *Game) float64 {
 	}
 
 	// Mobility bonus
-	aiMoves := len(ai.getAllPossibleMovesForColor(game, ai.color))
-	opponentMoves := len(ai.getAllPossibleMovesForColor(game, ai.getOpponentColor()))
+	aiMoves := game.mobility(ai.color)
+	opponentMoves := game.mobility(ai.getOpponentColor())
 	score += float64(aiMoves-opponentMoves) * 0.05
 
 	return score
@@ -419,24 +560,8 @@ func (ai *AI) evaluatePosition(game *Game) float64 {
 
 // Helper functions for AI optimizations
 
-func (ai *AI) hashPosition(game *Game) uint64 {
-	// Simple hash function for transposition table
-	hash := uint64(0)
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			piece := game.Board.GetPiece(NewPosition(row, col))
-			if piece != nil {
-				pieceValue := uint64(piece.Type) + uint64(piece.Color)*10
-				hash ^= pieceValue * uint64(row*8+col+1)
-			}
-		}
-	}
-	hash ^= uint64(game.CurrentPlayer) * 1000000
-	return hash
-}
-
 func (ai *AI) isCapture(move Move, game *Game) bool {
-	return game.Board.GetPiece(move.To) != nil
+	return game.Board.GetPiece(move.To) != nil || game.IsEnPassantMove(move)
 }
 
 func (ai *AI) isCenterMove(pos Position) bool {
@@ -454,55 +579,14 @@ func (ai *AI) isInCheck(game *Game, color Color) bool {
 	return game.isInCheck(color)
 }
 
-func (ai *AI) getAllPossibleMovesForColor(game *Game, color Color) []Move {
-	var moves []Move
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			from := NewPosition(row, col)
-			piece := game.Board.GetPiece(from)
-			if piece == nil || piece.Color != color {
-				continue
-			}
-			validMoves := game.Board.GetValidMoves(from)
-			moves = append(moves, validMoves...)
-		}
-	}
-	return moves
-}
-
-// getAllPossibleMoves returns all possible moves for the current player
+// getAllPossibleMoves returns all legal moves for the current player
 func (ai *AI) getAllPossibleMoves(game *Game) []Move {
-	return ai.getAllPossibleMovesForColor(game, game.CurrentPlayer)
+	return game.LegalMoves()
 }
 
 // copyGame creates a deep copy of the game state
 func (ai *AI) copyGame(game *Game) *Game {
-	newGame := &Game{
-		Board:         NewBoard(),
-		CurrentPlayer: game.CurrentPlayer,
-		State:         game.State,
-		MoveHistory:   make([]Move, len(game.MoveHistory)),
-	}
-
-	// Copy the board
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			pos := NewPosition(row, col)
-			piece := game.Board.GetPiece(pos)
-			if piece != nil {
-				newPiece := &Piece{
-					Type:  piece.Type,
-					Color: piece.Color,
-				}
-				newGame.Board.SetPiece(pos, newPiece)
-			}
-		}
-	}
-
-	// Copy move history
-	copy(newGame.MoveHistory, game.MoveHistory)
-
-	return newGame
+	return game.clone()
 }
 
 // findKing finds the king of the specified color
@@ -0,0 +1,131 @@
+package chess
+
+import "math/bits"
+
+// bitboard is a set of squares with one bit per square. Squares are numbered
+// row by row like Position, so bit 0 is a8, bit 7 is h8 and bit 63 is h1.
+type bitboard uint64
+
+// squareIndex returns the bit number of a position
+func squareIndex(pos Position) int {
+	return pos.Row*8 + pos.Col
+}
+
+// squarePosition returns the position of a bit number
+func squarePosition(sq int) Position {
+	return NewPosition(sq/8, sq%8)
+}
+
+// squareBit returns the bitboard holding only the given square
+func squareBit(sq int) bitboard {
+	return bitboard(1) << uint(sq)
+}
+
+// has reports whether the square is in the set
+func (bb bitboard) has(sq int) bool {
+	return bb&squareBit(sq) != 0
+}
+
+// count returns the number of squares in the set
+func (bb bitboard) count() int {
+	return bits.OnesCount64(uint64(bb))
+}
+
+// first returns the lowest numbered square in a non-empty set
+func (bb bitboard) first() int {
+	return bits.TrailingZeros64(uint64(bb))
+}
+
+// last returns the highest numbered square in a non-empty set
+func (bb bitboard) last() int {
+	return 63 - bits.LeadingZeros64(uint64(bb))
+}
+
+// popFirst removes and returns the lowest numbered square of a non-empty set
+func (bb *bitboard) popFirst() int {
+	sq := bb.first()
+	*bb &= *bb - 1
+	return sq
+}
+
+// lightSquares holds the light squares, starting with a8 in the lowest bit
+const lightSquares bitboard = 0xAA55AA55AA55AA55
+
+// Precomputed attack tables, filled in by init
+var (
+	knightAttacks [64]bitboard
+	kingAttacks   [64]bitboard
+	// pawnAttacks holds the squares a pawn of each color attacks from each square
+	pawnAttacks [2][64]bitboard
+	// rays holds, for each sliding direction, the squares from each square to the board edge
+	rays [8][64]bitboard
+)
+
+// slidingDirections lists the rook directions followed by the bishop directions
+var slidingDirections = [8][2]int{
+	{-1, 0}, {1, 0}, {0, -1}, {0, 1},
+	{-1, -1}, {-1, 1}, {1, -1}, {1, 1},
+}
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		from := squarePosition(sq)
+
+		knightAttacks[sq] = offsetTargets(from, knightOffsets[:])
+		kingAttacks[sq] = offsetTargets(from, kingOffsets[:])
+		pawnAttacks[White][sq] = offsetTargets(from, [][2]int{{-1, -1}, {-1, 1}})
+		pawnAttacks[Black][sq] = offsetTargets(from, [][2]int{{1, -1}, {1, 1}})
+
+		for d, dir := range slidingDirections {
+			for to := NewPosition(from.Row+dir[0], from.Col+dir[1]); to.IsValid(); to = NewPosition(to.Row+dir[0], to.Col+dir[1]) {
+				rays[d][sq] |= squareBit(squareIndex(to))
+			}
+		}
+	}
+}
+
+// offsetTargets returns the squares reached from a position by each offset
+func offsetTargets(from Position, offsets [][2]int) bitboard {
+	var targets bitboard
+	for _, offset := range offsets {
+		if to := NewPosition(from.Row+offset[0], from.Col+offset[1]); to.IsValid() {
+			targets |= squareBit(squareIndex(to))
+		}
+	}
+	return targets
+}
+
+// slidingAttacks returns the squares attacked along the given directions,
+// stopping at and including the first occupied square of each ray
+func slidingAttacks(sq int, occupied bitboard, directions []int) bitboard {
+	var attacks bitboard
+	for _, d := range directions {
+		ray := rays[d][sq]
+		if blockers := ray & occupied; blockers != 0 {
+			// Rays running towards higher square numbers meet their lowest blocker first
+			blocker := blockers.last()
+			if dir := slidingDirections[d]; dir[0]*8+dir[1] > 0 {
+				blocker = blockers.first()
+			}
+			ray &^= rays[d][blocker]
+		}
+		attacks |= ray
+	}
+	return attacks
+}
+
+// Direction indexes into slidingDirections for each kind of slider
+var (
+	rookRayIndexes   = []int{0, 1, 2, 3}
+	bishopRayIndexes = []int{4, 5, 6, 7}
+)
+
+// rookAttacks returns the squares a rook on sq attacks
+func rookAttacks(sq int, occupied bitboard) bitboard {
+	return slidingAttacks(sq, occupied, rookRayIndexes)
+}
+
+// bishopAttacks returns the squares a bishop on sq attacks
+func bishopAttacks(sq int, occupied bitboard) bitboard {
+	return slidingAttacks(sq, occupied, bishopRayIndexes)
+}
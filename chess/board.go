@@ -5,9 +5,18 @@ import (
 	"strings"
 )
 
-// Board represents the chess board
+// Board represents the chess board. Pieces are kept both in a square array,
+// which backs the Piece-based API, and in bitboards used for move generation
+// and attack detection.
 type Board struct {
 	squares [8][8]*Piece
+
+	// pieces holds the squares of each color's pieces of each type
+	pieces [2][6]bitboard
+	// colors holds the squares occupied by each color
+	colors [2]bitboard
+	// hash is the Zobrist hash of the piece placement
+	hash uint64
 }
 
 // NewBoard creates a new chess board with pieces in starting positions
@@ -20,40 +29,36 @@ func NewBoard() *Board {
 // setupInitialPosition sets up the initial chess position
 func (b *Board) setupInitialPosition() {
 	// Clear the board
-	for i := 0; i < 8; i++ {
-		for j := 0; j < 8; j++ {
-			b.squares[i][j] = nil
-		}
-	}
+	*b = Board{}
 
 	// Place white pieces
-	b.squares[7][0] = NewPiece(Rook, White)
-	b.squares[7][1] = NewPiece(Knight, White)
-	b.squares[7][2] = NewPiece(Bishop, White)
-	b.squares[7][3] = NewPiece(Queen, White)
-	b.squares[7][4] = NewPiece(King, White)
-	b.squares[7][5] = NewPiece(Bishop, White)
-	b.squares[7][6] = NewPiece(Knight, White)
-	b.squares[7][7] = NewPiece(Rook, White)
+	b.SetPiece(NewPosition(7, 0), NewPiece(Rook, White))
+	b.SetPiece(NewPosition(7, 1), NewPiece(Knight, White))
+	b.SetPiece(NewPosition(7, 2), NewPiece(Bishop, White))
+	b.SetPiece(NewPosition(7, 3), NewPiece(Queen, White))
+	b.SetPiece(NewPosition(7, 4), NewPiece(King, White))
+	b.SetPiece(NewPosition(7, 5), NewPiece(Bishop, White))
+	b.SetPiece(NewPosition(7, 6), NewPiece(Knight, White))
+	b.SetPiece(NewPosition(7, 7), NewPiece(Rook, White))
 
 	// Place white pawns
 	for i := 0; i < 8; i++ {
-		b.squares[6][i] = NewPiece(Pawn, White)
+		b.SetPiece(NewPosition(6, i), NewPiece(Pawn, White))
 	}
 
 	// Place black pieces
-	b.squares[0][0] = NewPiece(Rook, Black)
-	b.squares[0][1] = NewPiece(Knight, Black)
-	b.squares[0][2] = NewPiece(Bishop, Black)
-	b.squares[0][3] = NewPiece(Queen, Black)
-	b.squares[0][4] = NewPiece(King, Black)
-	b.squares[0][5] = NewPiece(Bishop, Black)
-	b.squares[0][6] = NewPiece(Knight, Black)
-	b.squares[0][7] = NewPiece(Rook, Black)
+	b.SetPiece(NewPosition(0, 0), NewPiece(Rook, Black))
+	b.SetPiece(NewPosition(0, 1), NewPiece(Knight, Black))
+	b.SetPiece(NewPosition(0, 2), NewPiece(Bishop, Black))
+	b.SetPiece(NewPosition(0, 3), NewPiece(Queen, Black))
+	b.SetPiece(NewPosition(0, 4), NewPiece(King, Black))
+	b.SetPiece(NewPosition(0, 5), NewPiece(Bishop, Black))
+	b.SetPiece(NewPosition(0, 6), NewPiece(Knight, Black))
+	b.SetPiece(NewPosition(0, 7), NewPiece(Rook, Black))
 
 	// Place black pawns
 	for i := 0; i < 8; i++ {
-		b.squares[1][i] = NewPiece(Pawn, Black)
+		b.SetPiece(NewPosition(1, i), NewPiece(Pawn, Black))
 	}
 }
 
@@ -67,9 +72,37 @@ func (b *Board) GetPiece(pos Position) *Piece {
 
 // SetPiece sets a piece at the given position
 func (b *Board) SetPiece(pos Position, piece *Piece) {
-	if pos.IsValid() {
-		b.squares[pos.Row][pos.Col] = piece
+	if !pos.IsValid() {
+		return
 	}
+
+	// Pieces of an unknown type or color stay off the bitboards and cannot move
+	sq := squareIndex(pos)
+	if old := b.squares[pos.Row][pos.Col]; old.isKnown() {
+		b.pieces[old.Color][old.Type] &^= squareBit(sq)
+		b.colors[old.Color] &^= squareBit(sq)
+		b.hash ^= zobristPieces[old.Color][old.Type][sq]
+	}
+	if piece.isKnown() {
+		b.pieces[piece.Color][piece.Type] |= squareBit(sq)
+		b.colors[piece.Color] |= squareBit(sq)
+		b.hash ^= zobristPieces[piece.Color][piece.Type][sq]
+	}
+	b.squares[pos.Row][pos.Col] = piece
+}
+
+// occupied returns the squares holding a piece of either color
+func (b *Board) occupied() bitboard {
+	return b.colors[White] | b.colors[Black]
+}
+
+// kingSquare returns the square of the player's king, or false if there is none
+func (b *Board) kingSquare(player Color) (int, bool) {
+	kings := b.pieces[player][King]
+	if kings == 0 {
+		return 0, false
+	}
+	return kings.first(), true
 }
 
 // MovePiece moves a piece from one position to another
@@ -90,6 +123,69 @@ func (b *Board) MovePiece(from, to Position) bool {
 	return true
 }
 
+// CastlingRights is a set of the castling moves that are still available
+type CastlingRights uint8
+
+const (
+	// WhiteKingSide allows White to castle with the h1 rook
+	WhiteKingSide CastlingRights = 1 << iota
+	// WhiteQueenSide allows White to castle with the a1 rook
+	WhiteQueenSide
+	// BlackKingSide allows Black to castle with the h8 rook
+	BlackKingSide
+	// BlackQueenSide allows Black to castle with the a8 rook
+	BlackQueenSide
+)
+
+// String returns the castling rights in FEN notation (e.g., "KQkq" or "-")
+func (cr CastlingRights) String() string {
+	var sb strings.Builder
+	if cr&WhiteKingSide != 0 {
+		sb.WriteString("K")
+	}
+	if cr&WhiteQueenSide != 0 {
+		sb.WriteString("Q")
+	}
+	if cr&BlackKingSide != 0 {
+		sb.WriteString("k")
+	}
+	if cr&BlackQueenSide != 0 {
+		sb.WriteString("q")
+	}
+	if sb.Len() == 0 {
+		return "-"
+	}
+	return sb.String()
+}
+
+// CastlingRights returns the castling rights implied by unmoved kings and rooks
+func (b *Board) CastlingRights() CastlingRights {
+	var rights CastlingRights
+	if b.isUnmoved(NewPosition(7, 4), King, White) {
+		if b.isUnmoved(NewPosition(7, 7), Rook, White) {
+			rights |= WhiteKingSide
+		}
+		if b.isUnmoved(NewPosition(7, 0), Rook, White) {
+			rights |= WhiteQueenSide
+		}
+	}
+	if b.isUnmoved(NewPosition(0, 4), King, Black) {
+		if b.isUnmoved(NewPosition(0, 7), Rook, Black) {
+			rights |= BlackKingSide
+		}
+		if b.isUnmoved(NewPosition(0, 0), Rook, Black) {
+			rights |= BlackQueenSide
+		}
+	}
+	return rights
+}
+
+// isUnmoved checks if the given piece stands on the square and has never moved
+func (b *Board) isUnmoved(pos Position, pieceType PieceType, color Color) bool {
+	piece := b.GetPiece(pos)
+	return piece != nil && piece.Type == pieceType && piece.Color == color && !piece.HasMoved
+}
+
 // String returns a string representation of the board
 func (b *Board) String() string {
 	var sb strings.Builder
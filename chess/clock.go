@@ -0,0 +1,317 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrClockStopped is returned by Clock.Press when the clock is not running
+var ErrClockStopped = errors.New("clock is not running")
+
+// TimePeriod is one stage of a time control
+type TimePeriod struct {
+	// Moves is the number of moves to play in this period, or 0 for the rest of the game
+	Moves int
+	// Time is added to a player's clock when they enter the period
+	Time time.Duration
+	// Increment is added after each move (Fischer increment)
+	Increment time.Duration
+	// Delay is the time each move may take before the clock counts down;
+	// time used within it is given back after the move (Bronstein delay)
+	Delay time.Duration
+}
+
+// TimeControl describes how much thinking time the players get. The last
+// period repeats when it has a move count, as in "40/120".
+type TimeControl struct {
+	Periods []TimePeriod
+}
+
+// SuddenDeath returns a time control with a fixed amount of time for the whole game
+func SuddenDeath(base time.Duration) TimeControl {
+	return TimeControl{Periods: []TimePeriod{{Time: base}}}
+}
+
+// Fischer returns a time control adding an increment after every move
+func Fischer(base, increment time.Duration) TimeControl {
+	return TimeControl{Periods: []TimePeriod{{Time: base, Increment: increment}}}
+}
+
+// Bronstein returns a time control giving back up to delay after every move
+func Bronstein(base, delay time.Duration) TimeControl {
+	return TimeControl{Periods: []TimePeriod{{Time: base, Delay: delay}}}
+}
+
+// ParseTimeControl parses a time control made of comma-separated periods,
+// each written as [moves/]minutes[+increment|dDelay] with the increment and
+// delay in seconds. Examples: "5" (sudden death), "3+2" (Fischer increment),
+// "15d5" (Bronstein delay) and "40/90+30,30+30" (90 minutes for 40 moves, then
+// 30 minutes for the rest of the game, with 30 seconds added per move).
+func ParseTimeControl(s string) (TimeControl, error) {
+	var control TimeControl
+	for _, spec := range strings.Split(s, ",") {
+		period, err := parseTimePeriod(strings.TrimSpace(spec))
+		if err != nil {
+			return TimeControl{}, fmt.Errorf("invalid time control %q: %v", s, err)
+		}
+		control.Periods = append(control.Periods, period)
+	}
+
+	for _, period := range control.Periods[:len(control.Periods)-1] {
+		if period.Moves == 0 {
+			return TimeControl{}, fmt.Errorf("invalid time control %q: only the last period may last the rest of the game", s)
+		}
+	}
+
+	return control, nil
+}
+
+// parseTimePeriod parses a single [moves/]minutes[+increment|dDelay] period
+func parseTimePeriod(spec string) (TimePeriod, error) {
+	var period TimePeriod
+
+	if moves, rest, ok := strings.Cut(spec, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n < 1 {
+			return TimePeriod{}, fmt.Errorf("invalid move count %q", moves)
+		}
+		period.Moves = n
+		spec = rest
+	}
+
+	var bonus string
+	var bonusField *time.Duration
+	if base, inc, ok := strings.Cut(spec, "+"); ok {
+		spec, bonus, bonusField = base, inc, &period.Increment
+	} else if base, delay, ok := strings.Cut(spec, "d"); ok {
+		spec, bonus, bonusField = base, delay, &period.Delay
+	}
+
+	// ParseFloat also accepts NaN and Inf. They, and other values too large
+	// for a Duration, would start a clock that has already run out.
+	minutes, err := strconv.ParseFloat(spec, 64)
+	if err != nil || math.IsNaN(minutes) || minutes <= 0 || minutes*float64(time.Minute) > math.MaxInt64 {
+		return TimePeriod{}, fmt.Errorf("invalid minutes %q", spec)
+	}
+	period.Time = time.Duration(minutes * float64(time.Minute))
+
+	if bonusField != nil {
+		seconds, err := strconv.ParseFloat(bonus, 64)
+		if err != nil || math.IsNaN(seconds) || seconds < 0 || seconds*float64(time.Second) > math.MaxInt64 {
+			return TimePeriod{}, fmt.Errorf("invalid seconds %q", bonus)
+		}
+		*bonusField = time.Duration(seconds * float64(time.Second))
+	}
+
+	return period, nil
+}
+
+// String returns the time control in the format accepted by ParseTimeControl
+func (tc TimeControl) String() string {
+	specs := make([]string, len(tc.Periods))
+	for i, period := range tc.Periods {
+		var sb strings.Builder
+		if period.Moves > 0 {
+			fmt.Fprintf(&sb, "%d/", period.Moves)
+		}
+		sb.WriteString(strconv.FormatFloat(period.Time.Minutes(), 'f', -1, 64))
+		if period.Increment > 0 {
+			fmt.Fprintf(&sb, "+%s", strconv.FormatFloat(period.Increment.Seconds(), 'f', -1, 64))
+		}
+		if period.Delay > 0 {
+			fmt.Fprintf(&sb, "d%s", strconv.FormatFloat(period.Delay.Seconds(), 'f', -1, 64))
+		}
+		specs[i] = sb.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// Clock is a chess clock for both players. Time is read from an injectable
+// source so tests can control it.
+type Clock struct {
+	control   TimeControl
+	now       func() time.Time
+	remaining [2]time.Duration
+	period    [2]int // index into control.Periods
+	moves     [2]int // moves made in the current period
+
+	running   bool
+	turn      Color
+	turnStart time.Time
+}
+
+// NewClock creates a stopped clock for the time control. A nil now uses the
+// system time.
+func NewClock(control TimeControl, now func() time.Time) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+
+	c := &Clock{control: control, now: now}
+	if len(control.Periods) > 0 {
+		c.remaining = [2]time.Duration{control.Periods[0].Time, control.Periods[0].Time}
+	}
+	return c
+}
+
+// TimeControl returns the time control the clock was created with
+func (c *Clock) TimeControl() TimeControl {
+	return c.control
+}
+
+// Start runs the clock for the given player
+func (c *Clock) Start(player Color) {
+	c.running = true
+	c.turn = player
+	c.turnStart = c.now()
+}
+
+// Stop halts the clock, charging the running player for the time used so far
+func (c *Clock) Stop() {
+	if !c.running {
+		return
+	}
+	c.remaining[c.turn] = c.Remaining(c.turn)
+	c.running = false
+}
+
+// Running reports whether the clock is running and for whom
+func (c *Clock) Running() (Color, bool) {
+	return c.turn, c.running
+}
+
+// Press ends the running player's move: the time used is charged, the part
+// of it within the delay and any increment are credited, the next period
+// begins when its move count is reached, and the opponent's clock starts. It
+// returns false if the player's flag had already fallen, in which case no
+// time is credited.
+func (c *Clock) Press() (bool, error) {
+	if !c.running {
+		return false, ErrClockStopped
+	}
+
+	player := c.turn
+	remaining := c.Remaining(player)
+	if remaining <= 0 {
+		c.remaining[player] = 0
+		c.running = false
+		return false, nil
+	}
+
+	period := c.currentPeriod(player)
+	remaining += min(c.now().Sub(c.turnStart), period.Delay) + period.Increment
+	c.moves[player]++
+	if period.Moves > 0 && c.moves[player] == period.Moves {
+		c.moves[player] = 0
+		if c.period[player] < len(c.control.Periods)-1 {
+			c.period[player]++
+		}
+		remaining += c.currentPeriod(player).Time
+	}
+	c.remaining[player] = remaining
+
+	c.Start(player.Opponent())
+	return true, nil
+}
+
+// Remaining returns the player's time left, counting the move in progress.
+// The delay is only given back when the move is made, so a player who runs
+// out of time loses even if part of it was within the delay.
+func (c *Clock) Remaining(player Color) time.Duration {
+	remaining := c.remaining[player]
+	if !c.running || c.turn != player {
+		return remaining
+	}
+	return remaining - c.now().Sub(c.turnStart)
+}
+
+// Flagged returns the player whose time has run out, if any
+func (c *Clock) Flagged() (Color, bool) {
+	for _, player := range []Color{White, Black} {
+		if c.Remaining(player) <= 0 {
+			return player, true
+		}
+	}
+	return White, false
+}
+
+// MovesToGo returns how many moves the player must make before the next
+// time period, or 0 when the current period lasts the rest of the game
+func (c *Clock) MovesToGo(player Color) int {
+	period := c.currentPeriod(player)
+	if period.Moves == 0 {
+		return 0
+	}
+	return period.Moves - c.moves[player]
+}
+
+// currentPeriod returns the period the player is in
+func (c *Clock) currentPeriod(player Color) TimePeriod {
+	if len(c.control.Periods) == 0 {
+		return TimePeriod{}
+	}
+	return c.control.Periods[c.period[player]]
+}
+
+// FormatDuration formats a clock reading as h:mm:ss, m:ss, or s.d under ten seconds
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < 10*time.Second {
+		return fmt.Sprintf("%.1f", d.Seconds())
+	}
+
+	d = d.Truncate(time.Second)
+	hours := int(d / time.Hour)
+	minutes := int(d%time.Hour) / int(time.Minute)
+	seconds := int(d%time.Minute) / int(time.Second)
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// CheckTime ends the game as a time forfeit if a player's flag has fallen on
+// the game clock, and reports whether it did
+func (g *Game) CheckTime() bool {
+	if g.Clock == nil || g.IsGameOver() {
+		return false
+	}
+
+	player, flagged := g.Clock.Flagged()
+	if !flagged {
+		return false
+	}
+
+	g.Clock.Stop()
+	g.State = TimeForfeit
+	g.loser = player
+	g.drawOffer = nil
+	return true
+}
+
+// pressClock ends the mover's turn on a running game clock and stops the
+// clock when the game is over
+func (g *Game) pressClock(mover Color) {
+	if g.Clock == nil {
+		return
+	}
+	if _, running := g.Clock.Running(); !running {
+		return
+	}
+
+	if ok, _ := g.Clock.Press(); !ok && !g.IsGameOver() {
+		// The flag fell while the move was being made
+		g.State = TimeForfeit
+		g.loser = mover
+		g.drawOffer = nil
+	}
+	if g.IsGameOver() {
+		g.Clock.Stop()
+	}
+}
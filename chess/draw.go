@@ -0,0 +1,161 @@
+package chess
+
+import "errors"
+
+// ErrNoDrawToClaim is returned by ClaimDraw when neither the fifty-move rule
+// nor threefold repetition applies
+var ErrNoDrawToClaim = errors.New("no draw can be claimed")
+
+// DrawReason explains why a game was drawn or which draw may be claimed
+type DrawReason int
+
+const (
+	// NoDraw indicates the game is not drawn
+	NoDraw DrawReason = iota
+	// FiftyMoveRule indicates fifty moves by each side without a capture or pawn move
+	FiftyMoveRule
+	// ThreefoldRepetition indicates the same position occurred three times
+	ThreefoldRepetition
+	// SeventyFiveMoveRule indicates seventy-five moves by each side without a capture or pawn move
+	SeventyFiveMoveRule
+	// FivefoldRepetition indicates the same position occurred five times
+	FivefoldRepetition
+	// InsufficientMaterial indicates neither side has the material to checkmate
+	InsufficientMaterial
+	// Agreement indicates the players agreed to a draw
+	Agreement
+)
+
+func (dr DrawReason) String() string {
+	switch dr {
+	case NoDraw:
+		return "no draw"
+	case FiftyMoveRule:
+		return "fifty-move rule"
+	case ThreefoldRepetition:
+		return "threefold repetition"
+	case SeventyFiveMoveRule:
+		return "seventy-five-move rule"
+	case FivefoldRepetition:
+		return "fivefold repetition"
+	case InsufficientMaterial:
+		return "insufficient material"
+	case Agreement:
+		return "agreement"
+	default:
+		return UnknownValue
+	}
+}
+
+// ClaimableDraw returns the draw the player to move may claim, or NoDraw.
+// The fifty-move rule and threefold repetition only end the game when claimed;
+// their seventy-five-move and fivefold counterparts end it automatically.
+func (g *Game) ClaimableDraw() DrawReason {
+	if g.IsGameOver() {
+		return NoDraw
+	}
+	if g.HalfmoveClock >= 100 {
+		return FiftyMoveRule
+	}
+	if g.repetitionCount() >= 3 {
+		return ThreefoldRepetition
+	}
+	return NoDraw
+}
+
+// ClaimDraw ends the game as a draw by the fifty-move rule or threefold repetition
+func (g *Game) ClaimDraw() error {
+	reason := g.ClaimableDraw()
+	if reason == NoDraw {
+		return ErrNoDrawToClaim
+	}
+
+	g.State = Draw
+	g.DrawReason = reason
+	return nil
+}
+
+// automaticDraw returns the reason the current position is drawn without a claim, or NoDraw
+func (g *Game) automaticDraw() DrawReason {
+	if g.Board.hasInsufficientMaterial() {
+		return InsufficientMaterial
+	}
+	if g.HalfmoveClock >= 150 {
+		return SeventyFiveMoveRule
+	}
+	if g.repetitionCount() >= 5 {
+		return FivefoldRepetition
+	}
+	return NoDraw
+}
+
+// repetitionCount returns how many times the current position has occurred
+func (g *Game) repetitionCount() int {
+	if len(g.positionHashes) == 0 {
+		return 1
+	}
+
+	// Captures and pawn moves are irreversible, so only positions since the
+	// last one can repeat
+	last := len(g.positionHashes) - 1
+	first := last - g.HalfmoveClock
+	if first < 0 {
+		first = 0
+	}
+
+	count := 0
+	for i := last; i >= first; i -= 2 {
+		if g.positionHashes[i] == g.positionHashes[last] {
+			count++
+		}
+	}
+	return count
+}
+
+// repeats reports whether the current position occurred before at or after
+// the given index of the position history, or has occurred three times in all
+func (g *Game) repeats(since int) bool {
+	last := len(g.positionHashes) - 1
+	first := max(last-g.HalfmoveClock, 0)
+
+	count := 1
+	for i := last - 2; i >= first; i -= 2 {
+		if g.positionHashes[i] == g.positionHashes[last] {
+			if i >= since {
+				return true
+			}
+			count++
+		}
+	}
+	return count >= 3
+}
+
+// hasInsufficientMaterial reports whether no sequence of moves can lead to
+// checkmate: bare kings, a single minor piece, or only bishops all on squares
+// of the same color
+func (b *Board) hasInsufficientMaterial() bool {
+	var knights, bishops bitboard
+	for _, color := range []Color{White, Black} {
+		pieces := &b.pieces[color]
+		if pieces[Pawn]|pieces[Rook]|pieces[Queen] != 0 {
+			return false
+		}
+		knights |= pieces[Knight]
+		bishops |= pieces[Bishop]
+	}
+
+	if knights == 0 {
+		return bishops&lightSquares == 0 || bishops&^lightSquares == 0
+	}
+	return knights.count() == 1 && bishops == 0
+}
+
+// canCheckmate reports whether the player has enough material left for some
+// sequence of legal moves to checkmate the opponent
+func (b *Board) canCheckmate(player Color) bool {
+	if b.hasInsufficientMaterial() {
+		return false
+	}
+
+	return b.colors[player]&^b.pieces[player][King] != 0
+}
@@ -0,0 +1,252 @@
+package chess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StartFEN is the FEN of the standard starting position
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// ParseFEN creates a game from a position in Forsyth-Edwards Notation.
+// The halfmove clock and fullmove number may be omitted and default to 0 and 1.
+func ParseFEN(fen string) (*Game, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 4 && len(fields) != 6 {
+		return nil, fmt.Errorf("invalid FEN %q: expected 4 or 6 fields, got %d", fen, len(fields))
+	}
+
+	game := &Game{
+		Board:          &Board{},
+		MoveHistory:    make([]Move, 0),
+		FullmoveNumber: 1,
+	}
+
+	if err := parseFENPlacement(game.Board, fields[0]); err != nil {
+		return nil, fmt.Errorf("invalid FEN piece placement: %v", err)
+	}
+
+	switch fields[1] {
+	case "w":
+		game.CurrentPlayer = White
+	case "b":
+		game.CurrentPlayer = Black
+	default:
+		return nil, fmt.Errorf("invalid FEN side to move: %q", fields[1])
+	}
+
+	if err := parseFENCastling(game.Board, fields[2]); err != nil {
+		return nil, fmt.Errorf("invalid FEN castling rights: %v", err)
+	}
+
+	if err := parseFENEnPassant(game, fields[3]); err != nil {
+		return nil, fmt.Errorf("invalid FEN en passant square: %v", err)
+	}
+
+	if len(fields) == 6 {
+		halfmove, err := strconv.Atoi(fields[4])
+		if err != nil || halfmove < 0 {
+			return nil, fmt.Errorf("invalid FEN halfmove clock: %q", fields[4])
+		}
+		fullmove, err := strconv.Atoi(fields[5])
+		if err != nil || fullmove < 1 {
+			return nil, fmt.Errorf("invalid FEN fullmove number: %q", fields[5])
+		}
+		game.HalfmoveClock = halfmove
+		game.FullmoveNumber = fullmove
+	}
+
+	if game.isInCheck(game.CurrentPlayer.Opponent()) {
+		return nil, fmt.Errorf("invalid FEN: %s to move but %s is in check", game.CurrentPlayer, game.CurrentPlayer.Opponent())
+	}
+
+	game.positionHashes = []uint64{game.Hash()}
+	game.updateGameState()
+	game.startFEN = game.FEN()
+
+	return game, nil
+}
+
+// parseFENPlacement places the pieces described by the first FEN field on an empty board
+func parseFENPlacement(board *Board, placement string) error {
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("expected 8 ranks, got %d", len(ranks))
+	}
+
+	kings := map[Color]int{}
+	for row, rank := range ranks {
+		col := 0
+		for _, ch := range rank {
+			if ch >= '1' && ch <= '8' {
+				col += int(ch - '0')
+				continue
+			}
+
+			piece := pieceFromFEN(ch)
+			if piece == nil {
+				return fmt.Errorf("unknown piece %q in rank %d", ch, 8-row)
+			}
+			if col >= 8 {
+				return fmt.Errorf("rank %d has more than 8 squares", 8-row)
+			}
+			if piece.Type == Pawn && (row == 0 || row == 7) {
+				return fmt.Errorf("pawn on rank %d", 8-row)
+			}
+			if piece.Type == King {
+				kings[piece.Color]++
+			}
+
+			// Only the castling field decides which kings and rooks count as unmoved
+			piece.HasMoved = true
+			board.SetPiece(NewPosition(row, col), piece)
+			col++
+		}
+		if col != 8 {
+			return fmt.Errorf("rank %d has %d squares, expected 8", 8-row, col)
+		}
+	}
+
+	for _, color := range []Color{White, Black} {
+		if kings[color] != 1 {
+			return fmt.Errorf("expected exactly one %s king, found %d", color, kings[color])
+		}
+	}
+
+	return nil
+}
+
+// parseFENCastling marks the kings and rooks named by the castling field as unmoved
+func parseFENCastling(board *Board, castling string) error {
+	if castling == "-" {
+		return nil
+	}
+
+	seen := map[rune]bool{}
+	for _, ch := range castling {
+		if seen[ch] {
+			return fmt.Errorf("duplicate right %q in %q", ch, castling)
+		}
+		seen[ch] = true
+
+		var color Color
+		var homeRow, rookCol int
+		switch ch {
+		case 'K':
+			color, homeRow, rookCol = White, 7, 7
+		case 'Q':
+			color, homeRow, rookCol = White, 7, 0
+		case 'k':
+			color, homeRow, rookCol = Black, 0, 7
+		case 'q':
+			color, homeRow, rookCol = Black, 0, 0
+		default:
+			return fmt.Errorf("unknown right %q in %q", ch, castling)
+		}
+
+		king := board.GetPiece(NewPosition(homeRow, 4))
+		rook := board.GetPiece(NewPosition(homeRow, rookCol))
+		if king == nil || king.Type != King || king.Color != color ||
+			rook == nil || rook.Type != Rook || rook.Color != color {
+			return fmt.Errorf("right %q requires the %s king and rook on their starting squares", ch, color)
+		}
+		king.HasMoved = false
+		rook.HasMoved = false
+	}
+
+	return nil
+}
+
+// parseFENEnPassant validates and stores the en passant target square
+func parseFENEnPassant(game *Game, square string) error {
+	if square == "-" {
+		return nil
+	}
+
+	target, err := FromAlgebraic(square)
+	if err != nil {
+		return err
+	}
+
+	// The pawn that just made a double push stands in front of the target square
+	expectedRow, pawnRow := 2, 3
+	if game.CurrentPlayer == Black {
+		expectedRow, pawnRow = 5, 4
+	}
+	if target.Row != expectedRow {
+		return fmt.Errorf("%s is not on the rank behind a pawn that just moved two squares", square)
+	}
+
+	pawn := game.Board.GetPiece(NewPosition(pawnRow, target.Col))
+	if pawn == nil || pawn.Type != Pawn || pawn.Color == game.CurrentPlayer {
+		return fmt.Errorf("no %s pawn in front of %s", game.CurrentPlayer.Opponent(), square)
+	}
+
+	game.EnPassantTarget = &target
+	return nil
+}
+
+// FEN returns the current position in Forsyth-Edwards Notation
+func (g *Game) FEN() string {
+	var sb strings.Builder
+
+	for row := 0; row < 8; row++ {
+		empty := 0
+		for col := 0; col < 8; col++ {
+			piece := g.Board.GetPiece(NewPosition(row, col))
+			if piece == nil {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			sb.WriteString(pieceToFEN(piece))
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+		if row < 7 {
+			sb.WriteString("/")
+		}
+	}
+
+	side := "w"
+	if g.CurrentPlayer == Black {
+		side = "b"
+	}
+
+	enPassant := "-"
+	if g.EnPassantTarget != nil {
+		enPassant = g.EnPassantTarget.String()
+	}
+
+	fmt.Fprintf(&sb, " %s %s %s %d %d", side, g.Board.CastlingRights(), enPassant, g.HalfmoveClock, g.FullmoveNumber)
+	return sb.String()
+}
+
+// pieceFromFEN creates the piece for a FEN letter, or returns nil for an unknown letter
+func pieceFromFEN(ch rune) *Piece {
+	color := White
+	if ch >= 'a' && ch <= 'z' {
+		color = Black
+		ch -= 'a' - 'A'
+	}
+
+	for _, pieceType := range []PieceType{King, Queen, Rook, Bishop, Knight, Pawn} {
+		if pieceType.Letter() == string(ch) {
+			return NewPiece(pieceType, color)
+		}
+	}
+	return nil
+}
+
+// pieceToFEN returns the FEN letter for a piece, lowercase for Black
+func pieceToFEN(piece *Piece) string {
+	if piece.Color == Black {
+		return strings.ToLower(piece.Type.Letter())
+	}
+	return piece.Type.Letter()
+}
@@ -1,10 +1,26 @@
 package chess
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
+var (
+	// ErrInvalidMove is returned when a piece cannot move that way
+	ErrInvalidMove = errors.New("invalid move")
+	// ErrLeavesKingInCheck is returned when a move would leave the mover's own king in check
+	ErrLeavesKingInCheck = errors.New("move leaves king in check")
+	// ErrPromotionRequired is returned when a pawn reaches the last rank without a promotion choice
+	ErrPromotionRequired = errors.New("promotion piece required")
+	// ErrInvalidPromotion is returned for a promotion choice on a non-promoting move or to an illegal piece
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	// ErrNothingToUndo is returned by UndoMove when no move has been made
+	ErrNothingToUndo = errors.New("no move to undo")
+	// ErrNothingToRedo is returned by RedoMove when no move has been undone
+	ErrNothingToRedo = errors.New("no move to redo")
+)
+
 // GameState represents the current state of the game
 type GameState int
 
@@ -19,6 +35,10 @@ const (
 	Stalemate
 	// Draw indicates the game has ended in a draw
 	Draw
+	// Resigned indicates a player has resigned
+	Resigned
+	// TimeForfeit indicates a player has run out of time
+	TimeForfeit
 )
 
 func (gs GameState) String() string {
@@ -33,6 +53,10 @@ func (gs GameState) String() string {
 		return "Stalemate"
 	case Draw:
 		return "Draw"
+	case Resigned:
+		return "Resigned"
+	case TimeForfeit:
+		return "Time forfeit"
 	default:
 		return UnknownValue
 	}
@@ -44,20 +68,63 @@ type Game struct {
 	CurrentPlayer Color
 	State         GameState
 	MoveHistory   []Move
+
+	// DrawReason tells why the game was drawn when State is Draw, and is NoDraw otherwise
+	DrawReason DrawReason
+
+	// EnPassantTarget is the square a pawn skipped over with a double push on
+	// the previous move, or nil when no en passant capture is possible
+	EnPassantTarget *Position
+
+	// HalfmoveClock counts moves since the last capture or pawn move
+	HalfmoveClock int
+	// FullmoveNumber starts at 1 and is incremented after each Black move
+	FullmoveNumber int
+
+	// Tags holds PGN tag pairs such as Event or White used when exporting the game
+	Tags map[string]string
+
+	// startFEN is the position the game started from, or empty for the standard start
+	startFEN string
+
+	// Clock times the game when set and running; ApplyMove presses it after each move
+	Clock *Clock
+
+	// loser is the player who resigned or ran out of time when State is Resigned or TimeForfeit
+	loser Color
+	// drawOffer is the player whose draw offer is pending, or nil
+	drawOffer *Color
+
+	// positionHashes holds the Hash of every position of the game so far, for repetition detection
+	positionHashes []uint64
+
+	// undoRecords holds what each move in MoveHistory changed, for UndoMove
+	undoRecords []moveRecord
+	// redoMoves holds undone moves, most recently undone last, for RedoMove
+	redoMoves []Move
 }
 
 // NewGame creates a new chess game
 func NewGame() *Game {
-	return &Game{
-		Board:         NewBoard(),
-		CurrentPlayer: White,
-		State:         Playing,
-		MoveHistory:   make([]Move, 0),
+	game := &Game{
+		Board:          NewBoard(),
+		CurrentPlayer:  White,
+		State:          Playing,
+		MoveHistory:    make([]Move, 0),
+		FullmoveNumber: 1,
 	}
+	game.positionHashes = []uint64{game.Hash()}
+	return game
 }
 
 // MakeMove attempts to make a move and returns whether it was successful
 func (g *Game) MakeMove(from, to string) error {
+	return g.MakeMoveWithPromotion(from, to, NoPromotion)
+}
+
+// MakeMoveWithPromotion attempts to make a move, promoting a pawn that reaches
+// the last rank to the given piece type
+func (g *Game) MakeMoveWithPromotion(from, to string, promotion PieceType) error {
 	fromPos, err := FromAlgebraic(from)
 	if err != nil {
 		return fmt.Errorf("invalid from position: %v", err)
@@ -68,117 +135,316 @@ func (g *Game) MakeMove(from, to string) error {
 		return fmt.Errorf("invalid to position: %v", err)
 	}
 
-	move := NewMove(fromPos, toPos)
+	return g.ApplyMove(NewPromotionMove(fromPos, toPos, promotion))
+}
 
-	if !g.Board.IsValidMove(move, g.CurrentPlayer) {
-		return fmt.Errorf("invalid move")
+// ApplyMove makes a legal move for the current player. Any moves that were
+// undone and not yet redone are discarded. With a running clock the move
+// fails with ErrGameOver once a flag has fallen.
+func (g *Game) ApplyMove(move Move) error {
+	g.CheckTime()
+	if g.IsGameOver() {
+		return ErrGameOver
+	}
+	if err := g.validateMove(move); err != nil {
+		return err
 	}
 
-	// Make the move
-	g.Board.MovePiece(move.From, move.To)
+	g.redoMoves = nil
+	mover := g.CurrentPlayer
+	g.makeMove(move)
+	g.pressClock(mover)
+
+	return nil
+}
+
+// makeMove plays a move that is already known to be legal, records what is
+// needed to take it back and updates the game state
+func (g *Game) makeMove(move Move) {
+	record := g.playMove(move)
+	record.state = g.State
+	record.drawReason = g.DrawReason
+	record.drawOffer = g.drawOffer
+
 	g.MoveHistory = append(g.MoveHistory, move)
+	g.undoRecords = append(g.undoRecords, record)
 
-	// Switch players
-	if g.CurrentPlayer == White {
-		g.CurrentPlayer = Black
-	} else {
-		g.CurrentPlayer = White
+	// Moving declines the opponent's draw offer
+	if g.drawOffer != nil && *g.drawOffer == g.CurrentPlayer {
+		g.drawOffer = nil
 	}
 
 	// Update game state
+	g.positionHashes = append(g.positionHashes, g.Hash())
 	g.updateGameState()
+}
 
-	return nil
+// makeNullMove passes the move to the opponent, which the search uses to
+// test how good a position is. It must not be used when in check. It returns
+// the en passant target that no longer applies, for unmakeNullMove.
+func (g *Game) makeNullMove() *Position {
+	enPassantTarget := g.EnPassantTarget
+	g.EnPassantTarget = nil
+	g.CurrentPlayer = g.CurrentPlayer.Opponent()
+	return enPassantTarget
+}
+
+// unmakeNullMove takes back a null move
+func (g *Game) unmakeNullMove(enPassantTarget *Position) {
+	g.CurrentPlayer = g.CurrentPlayer.Opponent()
+	g.EnPassantTarget = enPassantTarget
+}
+
+// playMove changes the board, clocks, en passant target and player to move
+// for a legal move, without touching history or game state. The returned
+// record undoes it with takeBack.
+func (g *Game) playMove(move Move) moveRecord {
+	isEnPassant := g.IsEnPassantMove(move)
+	piece := g.Board.GetPiece(move.From)
+
+	record := moveRecord{
+		move:            move,
+		piece:           piece,
+		pieceHasMoved:   piece.HasMoved,
+		capturePos:      move.To,
+		enPassantTarget: g.EnPassantTarget,
+		halfmoveClock:   g.HalfmoveClock,
+		fullmoveNumber:  g.FullmoveNumber,
+	}
+	if isEnPassant {
+		record.capturePos = EnPassantCapturePosition(move)
+	}
+	record.captured = g.Board.GetPiece(record.capturePos)
+
+	// Pawn moves and captures reset the halfmove clock
+	if record.captured != nil || piece.Type == Pawn {
+		g.HalfmoveClock = 0
+	} else {
+		g.HalfmoveClock++
+	}
+	if g.CurrentPlayer == Black {
+		g.FullmoveNumber++
+	}
+
+	// Castling also relocates the rook next to the king
+	if g.Board.IsCastlingMove(move) {
+		record.rookHasMoved = g.Board.GetPiece(CastlingRookPosition(move)).HasMoved
+		g.Board.MovePiece(CastlingRookPosition(move), CastlingRookTarget(move))
+	}
+
+	// En passant removes the pawn that is passed rather than the one on the target square
+	if isEnPassant {
+		g.Board.SetPiece(record.capturePos, nil)
+	}
+
+	g.EnPassantTarget = g.doublePushTarget(move)
+
+	// Make the move
+	g.Board.MovePiece(move.From, move.To)
+	if move.Promotion != NoPromotion {
+		promoted := NewPiece(move.Promotion, g.CurrentPlayer)
+		promoted.HasMoved = true
+		g.Board.SetPiece(move.To, promoted)
+	}
+
+	g.CurrentPlayer = g.CurrentPlayer.Opponent()
+
+	return record
+}
+
+// validatePromotion checks that a promotion choice is given exactly when a pawn reaches the last rank
+func (g *Game) validatePromotion(move Move) error {
+	if !g.Board.IsPromotionMove(move) {
+		if move.Promotion != NoPromotion {
+			return ErrInvalidPromotion
+		}
+		return nil
+	}
+
+	for _, pieceType := range PromotionPieces {
+		if move.Promotion == pieceType {
+			return nil
+		}
+	}
+
+	if move.Promotion == NoPromotion {
+		return ErrPromotionRequired
+	}
+	return ErrInvalidPromotion
+}
+
+// IsEnPassantMove checks if the move is a valid en passant capture for the current player
+func (g *Game) IsEnPassantMove(move Move) bool {
+	if g.EnPassantTarget == nil || move.To != *g.EnPassantTarget {
+		return false
+	}
+
+	piece := g.Board.GetPiece(move.From)
+	if piece == nil || piece.Type != Pawn || piece.Color != g.CurrentPlayer {
+		return false
+	}
+
+	direction := -1
+	if piece.Color == Black {
+		direction = 1
+	}
+
+	colDiff := move.To.Col - move.From.Col
+	return move.To.Row-move.From.Row == direction && (colDiff == 1 || colDiff == -1)
+}
+
+// EnPassantCapturePosition returns the square of the pawn captured by an en passant move
+func EnPassantCapturePosition(move Move) Position {
+	return NewPosition(move.From.Row, move.To.Col)
+}
+
+// enPassantMoves returns the en passant captures available to the player
+func (g *Game) enPassantMoves(player Color) []Move {
+	var moves []Move
+	if g.EnPassantTarget == nil || player != g.CurrentPlayer {
+		return moves
+	}
+
+	target := *g.EnPassantTarget
+	for _, col := range []int{target.Col - 1, target.Col + 1} {
+		// The capturing pawn stands beside the pawn that was pushed
+		from := NewPosition(target.Row+1, col)
+		if player == Black {
+			from = NewPosition(target.Row-1, col)
+		}
+		move := NewMove(from, target)
+		if from.IsValid() && g.IsEnPassantMove(move) {
+			moves = append(moves, move)
+		}
+	}
+
+	return moves
+}
+
+// doublePushTarget returns the square skipped by a two-square pawn move, or nil otherwise
+func (g *Game) doublePushTarget(move Move) *Position {
+	piece := g.Board.GetPiece(move.From)
+	if piece == nil || piece.Type != Pawn || move.From.Col != move.To.Col {
+		return nil
+	}
+
+	if rowDiff := move.To.Row - move.From.Row; rowDiff != 2 && rowDiff != -2 {
+		return nil
+	}
+
+	target := NewPosition((move.From.Row+move.To.Row)/2, move.From.Col)
+	return &target
 }
 
-// updateGameState updates the current game state
+// updateGameState updates the current game state. Checkmate and stalemate take
+// precedence over the draws that apply without a claim.
 func (g *Game) updateGameState() {
+	g.DrawReason = NoDraw
+
 	if g.isInCheck(g.CurrentPlayer) {
 		if g.hasValidMoves(g.CurrentPlayer) {
 			g.State = Check
 		} else {
 			g.State = Checkmate
+			return
 		}
 	} else if !g.hasValidMoves(g.CurrentPlayer) {
 		g.State = Stalemate
+		return
 	} else {
 		g.State = Playing
 	}
+
+	if reason := g.automaticDraw(); reason != NoDraw {
+		g.State = Draw
+		g.DrawReason = reason
+	}
 }
 
 // isInCheck checks if the given player's king is in check
 func (g *Game) isInCheck(player Color) bool {
-	// Find the king
-	var kingPos Position
-	found := false
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			pos := NewPosition(row, col)
-			piece := g.Board.GetPiece(pos)
-			if piece != nil && piece.Type == King && piece.Color == player {
-				kingPos = pos
-				found = true
-				break
-			}
-		}
-		if found {
-			break
-		}
-	}
-
+	kingSq, found := g.Board.kingSquare(player)
 	if !found {
 		return false
 	}
 
 	// Check if any opponent piece can attack the king
-	opponent := Black
-	if player == Black {
-		opponent = White
-	}
+	return g.Board.IsSquareAttacked(squarePosition(kingSq), player.Opponent())
+}
 
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			pos := NewPosition(row, col)
-			piece := g.Board.GetPiece(pos)
-			if piece != nil && piece.Color == opponent {
-				move := NewMove(pos, kingPos)
-				if g.Board.IsValidMove(move, opponent) {
-					return true
-				}
+// hasValidMoves checks if the player has any valid moves. It walks the move
+// targets directly rather than building a move list, since it runs after every move.
+func (g *Game) hasValidMoves(player Color) bool {
+	for pieces := g.Board.colors[player]; pieces != 0; {
+		sq := pieces.popFirst()
+		from := squarePosition(sq)
+		for targets := g.Board.moveTargets(sq, g.Board.GetPiece(from)); targets != 0; {
+			if !g.leavesKingInCheck(NewMove(from, squarePosition(targets.popFirst())), player) {
+				return true
 			}
 		}
 	}
 
+	for _, move := range g.enPassantMoves(player) {
+		if !g.leavesKingInCheck(move, player) {
+			return true
+		}
+	}
 	return false
 }
 
-// hasValidMoves checks if the player has any valid moves
-func (g *Game) hasValidMoves(player Color) bool {
+// clone creates a deep copy of the game state. The copy has no undo or redo history.
+func (g *Game) clone() *Game {
+	newGame := &Game{
+		Board:          &Board{},
+		CurrentPlayer:  g.CurrentPlayer,
+		State:          g.State,
+		MoveHistory:    make([]Move, len(g.MoveHistory)),
+		HalfmoveClock:  g.HalfmoveClock,
+		FullmoveNumber: g.FullmoveNumber,
+		DrawReason:     g.DrawReason,
+		loser:          g.loser,
+		startFEN:       g.startFEN,
+		positionHashes: append([]uint64(nil), g.positionHashes...),
+	}
+
+	// Copy the board
 	for row := 0; row < 8; row++ {
 		for col := 0; col < 8; col++ {
 			pos := NewPosition(row, col)
 			piece := g.Board.GetPiece(pos)
-			if piece != nil && piece.Color == player {
-				moves := g.Board.GetValidMoves(pos)
-				for _, move := range moves {
-					// Try the move and see if it leaves the king in check
-					originalPiece := g.Board.GetPiece(move.To)
-					g.Board.MovePiece(move.From, move.To)
-
-					inCheck := g.isInCheck(player)
-
-					// Undo the move
-					g.Board.MovePiece(move.To, move.From)
-					g.Board.SetPiece(move.To, originalPiece)
-
-					if !inCheck {
-						return true
-					}
+			if piece != nil {
+				newPiece := &Piece{
+					Type:     piece.Type,
+					Color:    piece.Color,
+					HasMoved: piece.HasMoved,
 				}
+				newGame.Board.SetPiece(pos, newPiece)
 			}
 		}
 	}
-	return false
+
+	// Copy move history
+	copy(newGame.MoveHistory, g.MoveHistory)
+
+	if g.EnPassantTarget != nil {
+		target := *g.EnPassantTarget
+		newGame.EnPassantTarget = &target
+	}
+
+	if g.drawOffer != nil {
+		offerer := *g.drawOffer
+		newGame.drawOffer = &offerer
+	}
+
+	if g.Tags != nil {
+		newGame.Tags = make(map[string]string, len(g.Tags))
+		for name, value := range g.Tags {
+			newGame.Tags[name] = value
+		}
+	}
+
+	return newGame
 }
 
 // GetGameStatus returns a string describing the current game status
@@ -191,13 +457,29 @@ func (g *Game) GetGameStatus() string {
 	if g.State == Check {
 		sb.WriteString(fmt.Sprintf("%s is in check!\n", g.CurrentPlayer))
 	} else if g.State == Checkmate {
-		winner := Black
-		if g.CurrentPlayer == Black {
-			winner = White
-		}
-		sb.WriteString(fmt.Sprintf("Checkmate! %s wins!\n", winner))
+		sb.WriteString(fmt.Sprintf("Checkmate! %s wins!\n", g.CurrentPlayer.Opponent()))
 	} else if g.State == Stalemate {
 		sb.WriteString("Stalemate! The game is a draw.\n")
+	} else if g.State == Draw {
+		sb.WriteString(fmt.Sprintf("Draw by %s!\n", g.DrawReason))
+	} else if g.State == Resigned {
+		sb.WriteString(fmt.Sprintf("%s resigns. %s wins!\n", g.loser, g.loser.Opponent()))
+	} else if g.State == TimeForfeit {
+		if g.Result() == Drawn {
+			sb.WriteString(fmt.Sprintf("%s ran out of time, but %s cannot checkmate. The game is a draw.\n", g.loser, g.loser.Opponent()))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s ran out of time. %s wins!\n", g.loser, g.loser.Opponent()))
+		}
+	}
+
+	if result := g.Result(); result != NoResult {
+		sb.WriteString(fmt.Sprintf("Result: %s by %s\n", result, g.Termination()))
+	}
+	if reason := g.ClaimableDraw(); reason != NoDraw {
+		sb.WriteString(fmt.Sprintf("%s may claim a draw by %s.\n", g.CurrentPlayer, reason))
+	}
+	if offerer, ok := g.DrawOffer(); ok {
+		sb.WriteString(fmt.Sprintf("%s offers a draw.\n", offerer))
 	}
 
 	return sb.String()
@@ -205,5 +487,9 @@ func (g *Game) GetGameStatus() string {
 
 // IsGameOver returns true if the game is over
 func (g *Game) IsGameOver() bool {
-	return g.State == Checkmate || g.State == Stalemate || g.State == Draw
+	switch g.State {
+	case Checkmate, Stalemate, Draw, Resigned, TimeForfeit:
+		return true
+	}
+	return false
 }
@@ -1,8 +1,14 @@
 package chess
 
 import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewGame(t *testing.T) {
@@ -761,3 +767,2457 @@ func TestComplexGameScenario(t *testing.T) {
 		t.Error("Black knight should be on f6")
 	}
 }
+
+// setupCastlingBoard leaves only the kings and rooks on their starting squares
+func setupCastlingBoard(game *Game) {
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			game.Board.SetPiece(NewPosition(i, j), nil)
+		}
+	}
+	game.Board.SetPiece(NewPosition(7, 4), NewPiece(King, White))
+	game.Board.SetPiece(NewPosition(7, 0), NewPiece(Rook, White))
+	game.Board.SetPiece(NewPosition(7, 7), NewPiece(Rook, White))
+	game.Board.SetPiece(NewPosition(0, 4), NewPiece(King, Black))
+	game.Board.SetPiece(NewPosition(0, 0), NewPiece(Rook, Black))
+	game.Board.SetPiece(NewPosition(0, 7), NewPiece(Rook, Black))
+}
+
+func TestCastlingKingSide(t *testing.T) {
+	game := NewGame()
+	setupCastlingBoard(game)
+
+	if err := game.MakeMove("e1", "g1"); err != nil {
+		t.Fatalf("Expected king-side castling to be valid, got error: %v", err)
+	}
+
+	king := game.Board.GetPiece(NewPosition(7, 6)) // g1
+	if king == nil || king.Type != King {
+		t.Error("King should be on g1 after castling")
+	}
+	rook := game.Board.GetPiece(NewPosition(7, 5)) // f1
+	if rook == nil || rook.Type != Rook || !rook.HasMoved {
+		t.Error("Rook should have moved to f1 after castling")
+	}
+	if game.Board.GetPiece(NewPosition(7, 7)) != nil {
+		t.Error("h1 should be empty after castling")
+	}
+
+	lastMove := game.MoveHistory[len(game.MoveHistory)-1]
+	if lastMove.From.String() != "e1" || lastMove.To.String() != "g1" {
+		t.Error("Move history should record the castling king move")
+	}
+}
+
+func TestCastlingQueenSide(t *testing.T) {
+	game := NewGame()
+	setupCastlingBoard(game)
+	game.CurrentPlayer = Black
+
+	if err := game.MakeMove("e8", "c8"); err != nil {
+		t.Fatalf("Expected queen-side castling to be valid, got error: %v", err)
+	}
+
+	rook := game.Board.GetPiece(NewPosition(0, 3)) // d8
+	if rook == nil || rook.Type != Rook || rook.Color != Black {
+		t.Error("Rook should have moved to d8 after castling")
+	}
+	if game.Board.GetPiece(NewPosition(0, 0)) != nil {
+		t.Error("a8 should be empty after castling")
+	}
+}
+
+func TestCastlingFromStartPosition(t *testing.T) {
+	game := NewGame()
+
+	moves := [][]string{
+		{"e2", "e4"}, {"e7", "e5"},
+		{"g1", "f3"}, {"b8", "c6"},
+		{"f1", "c4"}, {"g8", "f6"},
+	}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+
+	if err := game.MakeMove("e1", "g1"); err != nil {
+		t.Errorf("Expected castling after development, got error: %v", err)
+	}
+}
+
+func TestCastlingInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(game *Game)
+	}{
+		{"king has moved", func(game *Game) {
+			game.Board.GetPiece(NewPosition(7, 4)).HasMoved = true
+		}},
+		{"rook has moved", func(game *Game) {
+			game.Board.GetPiece(NewPosition(7, 7)).HasMoved = true
+		}},
+		{"path blocked", func(game *Game) {
+			game.Board.SetPiece(NewPosition(7, 5), NewPiece(Bishop, White))
+		}},
+		{"king in check", func(game *Game) {
+			game.Board.SetPiece(NewPosition(3, 4), NewPiece(Rook, Black)) // e5
+		}},
+		{"passing through check", func(game *Game) {
+			game.Board.SetPiece(NewPosition(3, 5), NewPiece(Rook, Black)) // f5
+		}},
+		{"landing in check", func(game *Game) {
+			game.Board.SetPiece(NewPosition(4, 3), NewPiece(Bishop, Black)) // d4 attacks g1
+		}},
+		{"rook missing", func(game *Game) {
+			game.Board.SetPiece(NewPosition(7, 7), nil)
+		}},
+	}
+
+	for _, test := range tests {
+		game := NewGame()
+		setupCastlingBoard(game)
+		test.setup(game)
+
+		if err := game.MakeMove("e1", "g1"); err == nil {
+			t.Errorf("Expected castling to be rejected when %s", test.name)
+		}
+	}
+}
+
+func TestCastlingQueenSideAttackedRookPath(t *testing.T) {
+	game := NewGame()
+	setupCastlingBoard(game)
+
+	// b1 being attacked does not prevent queen-side castling
+	game.Board.SetPiece(NewPosition(3, 1), NewPiece(Rook, Black)) // b5
+	if err := game.MakeMove("e1", "c1"); err != nil {
+		t.Errorf("Expected queen-side castling with attacked b1, got error: %v", err)
+	}
+}
+
+func TestIsSquareAttacked(t *testing.T) {
+	board := NewBoard()
+
+	// f3 is covered by white pawns and the g1 knight
+	if !board.IsSquareAttacked(NewPosition(5, 5), White) {
+		t.Error("f3 should be attacked by White")
+	}
+	// e4 is not attacked by anyone in the starting position
+	if board.IsSquareAttacked(NewPosition(4, 4), White) || board.IsSquareAttacked(NewPosition(4, 4), Black) {
+		t.Error("e4 should not be attacked in the starting position")
+	}
+	// f6 is covered by black pawns
+	if !board.IsSquareAttacked(NewPosition(2, 5), Black) {
+		t.Error("f6 should be attacked by Black")
+	}
+}
+
+func TestHasValidMovesPreservesHasMoved(t *testing.T) {
+	game := NewGame()
+	setupCastlingBoard(game)
+
+	game.hasValidMoves(White)
+
+	if game.Board.GetPiece(NewPosition(7, 4)).HasMoved {
+		t.Error("hasValidMoves should not mark the king as moved")
+	}
+}
+
+func TestEnPassantTargetTracking(t *testing.T) {
+	game := NewGame()
+
+	game.MakeMove("e2", "e4")
+	if game.EnPassantTarget == nil || game.EnPassantTarget.String() != "e3" {
+		t.Fatalf("Expected en passant target e3 after e2-e4, got %v", game.EnPassantTarget)
+	}
+
+	game.MakeMove("g8", "f6")
+	if game.EnPassantTarget != nil {
+		t.Errorf("Expected en passant target to be cleared, got %v", game.EnPassantTarget)
+	}
+}
+
+func TestEnPassantCapture(t *testing.T) {
+	game := NewGame()
+
+	moves := [][]string{
+		{"e2", "e4"}, {"a7", "a6"},
+		{"e4", "e5"}, {"d7", "d5"},
+	}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+
+	if err := game.MakeMove("e5", "d6"); err != nil {
+		t.Fatalf("Expected en passant capture to be valid, got error: %v", err)
+	}
+
+	pawn := game.Board.GetPiece(NewPosition(2, 3)) // d6
+	if pawn == nil || pawn.Type != Pawn || pawn.Color != White {
+		t.Error("White pawn should be on d6 after en passant")
+	}
+	if game.Board.GetPiece(NewPosition(3, 3)) != nil { // d5
+		t.Error("Captured black pawn should be removed from d5")
+	}
+}
+
+func TestEnPassantOnlyImmediately(t *testing.T) {
+	game := NewGame()
+
+	moves := [][]string{
+		{"e2", "e4"}, {"a7", "a6"},
+		{"e4", "e5"}, {"d7", "d5"},
+		{"h2", "h3"}, {"h7", "h6"},
+	}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+
+	if err := game.MakeMove("e5", "d6"); err == nil {
+		t.Error("En passant should only be possible right after the double push")
+	}
+}
+
+func TestEnPassantMovesForAI(t *testing.T) {
+	game := NewGame()
+	ai := NewAI(White, 1)
+
+	moves := [][]string{
+		{"e2", "e4"}, {"a7", "a6"},
+		{"e4", "e5"}, {"f7", "f5"},
+	}
+	for _, move := range moves {
+		game.MakeMove(move[0], move[1])
+	}
+
+	enPassant := NewMove(NewPosition(3, 4), NewPosition(2, 5)) // e5xf6
+	found := false
+	for _, move := range ai.getAllPossibleMoves(game) {
+		if move == enPassant {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("AI move generation should include the en passant capture")
+	}
+
+	gameCopy := ai.copyGame(game)
+	if gameCopy.EnPassantTarget == nil || *gameCopy.EnPassantTarget != *game.EnPassantTarget {
+		t.Error("copyGame should preserve the en passant target")
+	}
+}
+
+// setupPromotionBoard leaves a white pawn on e7 with both kings out of the way
+func setupPromotionBoard(game *Game) {
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			game.Board.SetPiece(NewPosition(i, j), nil)
+		}
+	}
+	game.Board.SetPiece(NewPosition(7, 0), NewPiece(King, White)) // a1
+	game.Board.SetPiece(NewPosition(0, 0), NewPiece(King, Black)) // a8
+	game.Board.SetPiece(NewPosition(1, 4), NewPiece(Pawn, White)) // e7
+}
+
+func TestPawnPromotion(t *testing.T) {
+	for _, pieceType := range PromotionPieces {
+		game := NewGame()
+		setupPromotionBoard(game)
+
+		if err := game.MakeMoveWithPromotion("e7", "e8", pieceType); err != nil {
+			t.Fatalf("Expected promotion to %s to be valid, got error: %v", pieceType, err)
+		}
+
+		piece := game.Board.GetPiece(NewPosition(0, 4)) // e8
+		if piece == nil || piece.Type != pieceType || piece.Color != White {
+			t.Errorf("Expected white %s on e8, got %v", pieceType, piece)
+		}
+
+		lastMove := game.MoveHistory[len(game.MoveHistory)-1]
+		if lastMove.Promotion != pieceType {
+			t.Errorf("Move history should record promotion to %s", pieceType)
+		}
+	}
+}
+
+func TestPawnPromotionRequiresChoice(t *testing.T) {
+	game := NewGame()
+	setupPromotionBoard(game)
+
+	if err := game.MakeMove("e7", "e8"); !errors.Is(err, ErrPromotionRequired) {
+		t.Errorf("Expected ErrPromotionRequired, got %v", err)
+	}
+	if piece := game.Board.GetPiece(NewPosition(1, 4)); piece == nil || piece.Type != Pawn {
+		t.Error("Pawn should stay on e7 after a rejected promotion")
+	}
+
+	if err := game.MakeMoveWithPromotion("e7", "e8", Pawn); !errors.Is(err, ErrInvalidPromotion) {
+		t.Errorf("Expected ErrInvalidPromotion for pawn promotion, got %v", err)
+	}
+	if err := game.MakeMoveWithPromotion("a1", "a2", Queen); !errors.Is(err, ErrInvalidPromotion) {
+		t.Errorf("Expected ErrInvalidPromotion for non-pawn move, got %v", err)
+	}
+}
+
+func TestParsePromotion(t *testing.T) {
+	tests := []struct {
+		letter   string
+		expected PieceType
+	}{
+		{"q", Queen}, {"R", Rook}, {"b", Bishop}, {"n", Knight},
+	}
+	for _, test := range tests {
+		pieceType, err := ParsePromotion(test.letter)
+		if err != nil || pieceType != test.expected {
+			t.Errorf("ParsePromotion(%q) = %v, %v; want %v", test.letter, pieceType, err, test.expected)
+		}
+	}
+
+	if _, err := ParsePromotion("k"); err == nil {
+		t.Error("Expected error for king promotion letter")
+	}
+}
+
+func TestMoveString(t *testing.T) {
+	move := NewMove(NewPosition(6, 4), NewPosition(4, 4))
+	if move.String() != "e2e4" {
+		t.Errorf("Expected 'e2e4', got '%s'", move.String())
+	}
+
+	move = NewPromotionMove(NewPosition(1, 4), NewPosition(0, 4), Knight)
+	if move.String() != "e7e8n" {
+		t.Errorf("Expected 'e7e8n', got '%s'", move.String())
+	}
+}
+
+func TestAIPromotionMoves(t *testing.T) {
+	game := NewGame()
+	setupPromotionBoard(game)
+	ai := NewAI(White, 1)
+
+	promotions := make(map[PieceType]bool)
+	for _, move := range ai.getAllPossibleMoves(game) {
+		if move.From == NewPosition(1, 4) {
+			promotions[move.Promotion] = true
+		}
+	}
+	for _, pieceType := range PromotionPieces {
+		if !promotions[pieceType] {
+			t.Errorf("AI should consider promotion to %s", pieceType)
+		}
+	}
+
+	move, found := ai.BestMove(game)
+	if !found || move.Promotion == NoPromotion {
+		t.Errorf("AI should promote the pawn, got %v", move)
+	}
+}
+
+func TestPinnedPieceCannotMove(t *testing.T) {
+	game := NewGame()
+	setupPromotionBoard(game)
+
+	// White knight on e2 is pinned against the king on e1 by the rook on e8
+	game.Board.SetPiece(NewPosition(7, 0), nil)
+	game.Board.SetPiece(NewPosition(7, 4), NewPiece(King, White))   // e1
+	game.Board.SetPiece(NewPosition(6, 4), NewPiece(Knight, White)) // e2
+	game.Board.SetPiece(NewPosition(1, 4), nil)
+	game.Board.SetPiece(NewPosition(0, 4), NewPiece(Rook, Black)) // e8
+
+	if err := game.MakeMove("e2", "c3"); !errors.Is(err, ErrLeavesKingInCheck) {
+		t.Errorf("Expected ErrLeavesKingInCheck for pinned knight, got %v", err)
+	}
+	if len(game.LegalMovesFrom(NewPosition(6, 4))) != 0 {
+		t.Error("Pinned knight should have no legal moves")
+	}
+}
+
+func TestKingCannotWalkIntoCheck(t *testing.T) {
+	game := NewGame()
+	setupPromotionBoard(game)
+	game.Board.SetPiece(NewPosition(1, 4), nil)
+	game.Board.SetPiece(NewPosition(0, 1), NewPiece(Rook, Black)) // b8 covers the b-file
+
+	if err := game.MakeMove("a1", "b1"); !errors.Is(err, ErrLeavesKingInCheck) {
+		t.Errorf("Expected ErrLeavesKingInCheck for king walking into check, got %v", err)
+	}
+	if err := game.MakeMove("a1", "a2"); err != nil {
+		t.Errorf("Expected safe king move to be legal, got error: %v", err)
+	}
+}
+
+func TestInvalidMoveError(t *testing.T) {
+	game := NewGame()
+
+	if err := game.MakeMove("e2", "e5"); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Expected ErrInvalidMove, got %v", err)
+	}
+}
+
+func TestLegalMovesStartPosition(t *testing.T) {
+	game := NewGame()
+
+	if moves := game.LegalMoves(); len(moves) != 20 {
+		t.Errorf("Expected 20 legal moves in the starting position, got %d", len(moves))
+	}
+	if !game.IsLegal(NewMove(NewPosition(6, 4), NewPosition(4, 4))) {
+		t.Error("e2-e4 should be legal")
+	}
+	if game.IsLegal(NewMove(NewPosition(7, 4), NewPosition(6, 4))) {
+		t.Error("Ke2 should not be legal with a pawn on e2")
+	}
+}
+
+func TestLegalMovesInCheck(t *testing.T) {
+	game := NewGame()
+
+	// Fool's mate: after 1. f3 e5 2. g4 Qh4# White has no legal moves
+	moves := [][]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+
+	if game.State != Checkmate {
+		t.Errorf("Expected checkmate, got %v", game.State)
+	}
+	if moves := game.LegalMoves(); len(moves) != 0 {
+		t.Errorf("Expected no legal moves when checkmated, got %d", len(moves))
+	}
+}
+
+func TestEnPassantExposingKingIsIllegal(t *testing.T) {
+	game := NewGame()
+	setupPromotionBoard(game)
+	game.Board.SetPiece(NewPosition(1, 4), nil)
+
+	// White king a5, pawn b5; black pawn c7 pushes to c5, rook h5 waits on the rank
+	game.Board.SetPiece(NewPosition(7, 0), nil)
+	game.Board.SetPiece(NewPosition(3, 0), NewPiece(King, White))
+	game.Board.SetPiece(NewPosition(3, 1), NewPiece(Pawn, White))
+	game.Board.SetPiece(NewPosition(1, 2), NewPiece(Pawn, Black))
+	game.Board.SetPiece(NewPosition(3, 7), NewPiece(Rook, Black))
+	game.CurrentPlayer = Black
+
+	if err := game.MakeMove("c7", "c5"); err != nil {
+		t.Fatalf("Expected double push to be legal, got error: %v", err)
+	}
+	if err := game.MakeMove("b5", "c6"); !errors.Is(err, ErrLeavesKingInCheck) {
+		t.Errorf("Expected en passant exposing the king to be illegal, got %v", err)
+	}
+}
+
+func TestFENStartPosition(t *testing.T) {
+	game := NewGame()
+	if fen := game.FEN(); fen != StartFEN {
+		t.Errorf("Expected start FEN %q, got %q", StartFEN, fen)
+	}
+
+	parsed, err := ParseFEN(StartFEN)
+	if err != nil {
+		t.Fatalf("Failed to parse start FEN: %v", err)
+	}
+	if parsed.Board.String() != game.Board.String() {
+		t.Error("Parsed start position should match NewGame board")
+	}
+	if parsed.Board.CastlingRights() != WhiteKingSide|WhiteQueenSide|BlackKingSide|BlackQueenSide {
+		t.Errorf("Expected all castling rights, got %s", parsed.Board.CastlingRights())
+	}
+}
+
+func TestFENAfterMoves(t *testing.T) {
+	game := NewGame()
+	game.MakeMove("e2", "e4")
+	if fen := game.FEN(); fen != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1" {
+		t.Errorf("Unexpected FEN after e4: %s", fen)
+	}
+
+	game.MakeMove("g8", "f6")
+	game.MakeMove("e1", "e2")
+	if fen := game.FEN(); fen != "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPPKPPP/RNBQ1BNR b kq - 2 2" {
+		t.Errorf("Unexpected FEN after Ke2: %s", fen)
+	}
+}
+
+func TestFENRoundTrip(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/8/8/8/8/8/8/R3K2R b Kq - 12 40",
+	}
+
+	for _, fen := range fens {
+		game, err := ParseFEN(fen)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", fen, err)
+			continue
+		}
+		if got := game.FEN(); got != fen {
+			t.Errorf("Round trip mismatch: expected %q, got %q", fen, got)
+		}
+	}
+}
+
+func TestParseFENFields(t *testing.T) {
+	game, err := ParseFEN("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	if game.CurrentPlayer != White || game.FullmoveNumber != 3 || game.HalfmoveClock != 0 {
+		t.Error("Side to move and move counters should be parsed")
+	}
+	if err := game.MakeMove("e5", "f6"); err != nil {
+		t.Errorf("En passant from FEN should be playable, got error: %v", err)
+	}
+
+	game, err = ParseFEN("4k3/8/8/8/8/8/8/4K2R w K -")
+	if err != nil {
+		t.Fatalf("Failed to parse four-field FEN: %v", err)
+	}
+	if game.HalfmoveClock != 0 || game.FullmoveNumber != 1 {
+		t.Error("Omitted move counters should default to 0 and 1")
+	}
+	if err := game.MakeMove("e1", "g1"); err != nil {
+		t.Errorf("Castling right from FEN should be playable, got error: %v", err)
+	}
+
+	game, _ = ParseFEN("4k3/8/8/8/8/8/8/4K2R w - - 0 1")
+	if err := game.MakeMove("e1", "g1"); err == nil {
+		t.Error("Castling should be rejected without the FEN castling right")
+	}
+}
+
+func TestParseFENCheckmate(t *testing.T) {
+	game, err := ParseFEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	if game.State != Checkmate {
+		t.Errorf("Expected checkmate state from FEN, got %v", game.State)
+	}
+}
+
+func TestParseFENErrors(t *testing.T) {
+	tests := []struct {
+		fen     string
+		message string
+	}{
+		{"", "expected 4 or 6 fields"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1", "expected 8 ranks"},
+		{"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "unknown piece"},
+		{"rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "has 7 squares"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNRR w KQkq - 0 1", "more than 8 squares"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQ1BNR w kq - 0 1", "exactly one White king"},
+		{"Pnbqkbnr/pppppppp/8/8/8/8/1PPPPPPP/RNBQKBNR w KQkq - 0 1", "pawn on rank 8"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1", "side to move"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkx - 0 1", "unknown right"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KK - 0 1", "duplicate right"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1 w K - 0 1", "starting squares"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e4 0 1", "en passant"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1", "no Black pawn"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1", "halfmove clock"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0", "fullmove number"},
+		{"4k3/8/8/8/8/8/8/4K2R w - - 0 1", ""},
+		{"4k2R/8/8/8/8/8/8/4K3 w - - 0 1", "Black is in check"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseFEN(test.fen)
+		if test.message == "" {
+			if err != nil {
+				t.Errorf("Expected %q to parse, got error: %v", test.fen, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Expected error containing %q for %q, got %v", test.message, test.fen, err)
+		}
+	}
+}
+
+func TestPGNExport(t *testing.T) {
+	game := NewGame()
+	game.Tags = map[string]string{"White": "Alice", "Black": "Bob", "Annotator": "Test"}
+
+	// Scholar's mate
+	moves := [][]string{
+		{"e2", "e4"}, {"e7", "e5"},
+		{"f1", "c4"}, {"b8", "c6"},
+		{"d1", "h5"}, {"g8", "f6"},
+		{"h5", "f7"},
+	}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+
+	expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]
+[Annotator "Test"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+`
+	if pgn := game.PGN(); pgn != expected {
+		t.Errorf("Unexpected PGN:\n%s\nexpected:\n%s", pgn, expected)
+	}
+}
+
+func TestPGNExportInProgress(t *testing.T) {
+	game := NewGame()
+	game.MakeMove("e2", "e4")
+
+	pgn := game.PGN()
+	if !strings.Contains(pgn, `[Result "*"]`) || !strings.HasSuffix(pgn, "1. e4 *\n") {
+		t.Errorf("In-progress game should have result '*', got:\n%s", pgn)
+	}
+}
+
+func TestPGNExportFromFEN(t *testing.T) {
+	game, err := ParseFEN("4k3/8/8/8/8/8/4P3/4K2R b K - 0 30")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	game.MakeMove("e8", "d7")
+	game.MakeMove("e1", "g1")
+
+	pgn := game.PGN()
+	if !strings.Contains(pgn, `[SetUp "1"]`) || !strings.Contains(pgn, `[FEN "4k3/8/8/8/8/8/4P3/4K2R b K - 0 30"]`) {
+		t.Errorf("PGN from a FEN start should include SetUp and FEN tags, got:\n%s", pgn)
+	}
+	if !strings.Contains(pgn, "30... Kd7 31. O-O *") {
+		t.Errorf("PGN movetext should start with a Black move number, got:\n%s", pgn)
+	}
+}
+
+func TestPGNLineWrapping(t *testing.T) {
+	game := NewGame()
+	for i := 0; i < 10; i++ {
+		game.MakeMove("g1", "f3")
+		game.MakeMove("g8", "f6")
+		game.MakeMove("f3", "g1")
+		game.MakeMove("f6", "g8")
+	}
+
+	lines := strings.Split(game.PGN(), "\n")
+	for _, line := range lines {
+		if len(line) > pgnLineWidth {
+			t.Errorf("PGN line longer than %d characters: %q", pgnLineWidth, line)
+		}
+	}
+}
+
+func TestPGNTagEscaping(t *testing.T) {
+	game := NewGame()
+	game.Tags = map[string]string{"Event": `The "Big" One \ 2024`}
+
+	if pgn := game.PGN(); !strings.Contains(pgn, `[Event "The \"Big\" One \\ 2024"]`) {
+		t.Errorf("Tag values should be escaped, got:\n%s", pgn)
+	}
+}
+
+func TestSANBase(t *testing.T) {
+	tests := []struct {
+		fen      string
+		from     string
+		to       string
+		promo    PieceType
+		expected string
+	}{
+		{StartFEN, "g1", "f3", NoPromotion, "Nf3"},
+		{StartFEN, "e2", "e4", NoPromotion, "e4"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/3PP3/8/PPP2PPP/RNBQKBNR w KQkq - 0 3", "d4", "e5", NoPromotion, "dxe5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5", "f6", NoPromotion, "exf6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1", "g1", NoPromotion, "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8", "c8", NoPromotion, "O-O-O"},
+		{"r3k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7", "a8", Knight, "bxa8=N"},
+		{"4k3/8/8/8/8/2N3N1/8/4K3 w - - 0 1", "c3", "e2", NoPromotion, "Nce2"},
+		{"4k3/8/8/8/8/2N5/8/2N1K3 w - - 0 1", "c1", "e2", NoPromotion, "N1e2"},
+		{"6k1/8/8/8/Q6Q/8/8/Q3K3 w - - 0 1", "a4", "d4", NoPromotion, "Qa4d4"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1", "d1", NoPromotion, "Rad1"},
+	}
+
+	for _, test := range tests {
+		game, err := ParseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", test.fen, err)
+		}
+		from, _ := FromAlgebraic(test.from)
+		to, _ := FromAlgebraic(test.to)
+		move := NewPromotionMove(from, to, test.promo)
+		if san := game.sanBase(move); san != test.expected {
+			t.Errorf("Expected %s for %s%s in %q, got %s", test.expected, test.from, test.to, test.fen, san)
+		}
+	}
+}
+
+const testPGNDatabase = `% Exported by a tool that writes escape lines
+[Event "Game One"]
+[Site "Somewhere"]
+[Date "2024.01.01"]
+[Round "1"]
+[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]
+
+1. e4 {King's pawn} e5 2. Nf3 $1 Nc6 (2... d6 3. d4 (3. Bc4 Be7) exd4) 3. Bb5 a6
+; a rest-of-line comment
+4. Ba4 Nf6 5. O-O Be7 1-0
+
+[Event "Game Two"]
+[Result "0-1"]
+
+1.f3 e5 2.g4?? Qh4# 0-1
+
+[Event "Game Three"]
+[SetUp "1"]
+[FEN "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1"]
+[Result "*"]
+
+1. b8=Q+ Kd7 2. Qb5+ *
+`
+
+func TestPGNReaderMultipleGames(t *testing.T) {
+	reader := NewPGNReader(strings.NewReader(testPGNDatabase))
+
+	game, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Failed to read first game: %v", err)
+	}
+	if game.Tags["Event"] != "Game One" || game.Tags["White"] != "Alice" {
+		t.Errorf("Tags should be read, got %v", game.Tags)
+	}
+	if len(game.MoveHistory) != 10 {
+		t.Errorf("Expected 10 plies in the main line, got %d", len(game.MoveHistory))
+	}
+	king := game.Board.GetPiece(NewPosition(7, 6)) // g1
+	if king == nil || king.Type != King {
+		t.Error("White should have castled king-side")
+	}
+
+	game, err = reader.Next()
+	if err != nil {
+		t.Fatalf("Failed to read second game: %v", err)
+	}
+	if game.State != Checkmate || game.resultToken() != "0-1" {
+		t.Errorf("Second game should end in checkmate for Black, got %v", game.State)
+	}
+
+	game, err = reader.Next()
+	if err != nil {
+		t.Fatalf("Failed to read third game: %v", err)
+	}
+	queen := game.Board.GetPiece(NewPosition(3, 1)) // b5
+	if queen == nil || queen.Type != Queen || queen.Color != White {
+		t.Error("Promoted queen should be on b5")
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last game, got %v", err)
+	}
+}
+
+func TestPGNReaderErrorReportsGameAndPly(t *testing.T) {
+	input := `[Event "Good"]
+
+1. e4 e5 *
+
+[Event "Bad"]
+
+1. e4 e5 2. Ke3 Nc6 *
+
+[Event "After"]
+
+1. d4 *
+`
+	reader := NewPGNReader(strings.NewReader(input))
+
+	if _, err := reader.Next(); err != nil {
+		t.Fatalf("First game should parse, got %v", err)
+	}
+
+	_, err := reader.Next()
+	var pgnErr *PGNError
+	if !errors.As(err, &pgnErr) {
+		t.Fatalf("Expected *PGNError, got %v", err)
+	}
+	if pgnErr.Game != 2 || pgnErr.Ply != 3 {
+		t.Errorf("Expected error at game 2, ply 3, got game %d, ply %d", pgnErr.Game, pgnErr.Ply)
+	}
+	if !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Expected ErrInvalidMove to be wrapped, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "pgn game 2, ply 3") {
+		t.Errorf("Error message should name game and ply, got %q", err.Error())
+	}
+
+	game, err := reader.Next()
+	if err != nil || game.Tags["Event"] != "After" {
+		t.Errorf("Reader should continue with the next game, got %v, %v", game, err)
+	}
+}
+
+func TestPGNReaderSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		pgn     string
+		message string
+	}{
+		{"1. e4 (1. d4 *", "unterminated variation"},
+		{"1. e4 ) e5 *", "unexpected ')'"},
+		{"1. e4 {never closed", "unterminated comment"},
+		{"1. e4 $x *", "invalid NAG"},
+		{"[Event Unquoted]\n1. e4 *", "invalid value for tag"},
+		{"[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n1. e4 *", "invalid FEN tag"},
+		{"1. e4 ] *", "unexpected character"},
+		{"1. Nf3 Nf6 2. Nbd2 *", "invalid move"},
+		{"1. Nf3 Nf6 2. Zz9 *", "invalid SAN move"},
+	}
+
+	for _, test := range tests {
+		_, err := ParsePGN(test.pgn)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Expected error containing %q for %q, got %v", test.message, test.pgn, err)
+		}
+	}
+}
+
+func TestPGNReaderRoundTrip(t *testing.T) {
+	game := NewGame()
+	moves := [][]string{
+		{"e2", "e4"}, {"d7", "d5"}, {"e4", "d5"}, {"g8", "f6"},
+		{"f1", "b5"}, {"c7", "c6"}, {"d5", "c6"}, {"d8", "a5"},
+		{"c6", "b7"}, {"c8", "d7"},
+	}
+	for _, move := range moves {
+		if err := game.MakeMove(move[0], move[1]); err != nil {
+			t.Fatalf("Move %s %s failed: %v", move[0], move[1], err)
+		}
+	}
+	game.MakeMoveWithPromotion("b7", "a8", Knight)
+
+	parsed, err := ParsePGN(game.PGN())
+	if err != nil {
+		t.Fatalf("Failed to parse exported PGN: %v", err)
+	}
+	if parsed.FEN() != game.FEN() {
+		t.Errorf("Round trip position mismatch: %s vs %s", parsed.FEN(), game.FEN())
+	}
+	if parsed.PGN() != game.PGN() {
+		t.Errorf("Round trip PGN mismatch:\n%s\nvs\n%s", parsed.PGN(), game.PGN())
+	}
+}
+
+func TestPGNReaderEmptyInput(t *testing.T) {
+	if _, err := NewPGNReader(strings.NewReader("  \n\n")).Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF for empty input, got %v", err)
+	}
+}
+
+func TestParseSANVariants(t *testing.T) {
+	game := NewGame()
+	for _, san := range []string{"e4", "e5", "Ngf3", "Nc6", "Bc4!?", "Nf6", "0-0", "Bc5", "d3", "d6", "Bg5", "h6", "Bxf6", "Qxf6"} {
+		move, err := game.ParseSAN(san)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", san, err)
+		}
+		if err := game.ApplyMove(move); err != nil {
+			t.Fatalf("Failed to apply %s: %v", san, err)
+		}
+	}
+
+	if _, err := game.ParseSAN("e8=Q"); err == nil {
+		t.Error("Expected error for an impossible promotion")
+	}
+}
+
+func TestSANSuffixes(t *testing.T) {
+	game, _ := ParseFEN("rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2")
+	mate, _ := game.ParseSAN("Qh4")
+	if san := game.SAN(mate); san != "Qh4#" {
+		t.Errorf("Expected Qh4#, got %s", san)
+	}
+
+	game, _ = ParseFEN("4k3/1P6/8/8/8/8/8/4K3 w - - 0 1")
+	promotion := NewPromotionMove(NewPosition(1, 1), NewPosition(0, 1), Queen)
+	if san := game.SAN(promotion); san != "b8=Q+" {
+		t.Errorf("Expected b8=Q+, got %s", san)
+	}
+
+	// SAN must not change the game it describes
+	if game.Board.GetPiece(NewPosition(1, 1)) == nil || len(game.MoveHistory) != 0 {
+		t.Error("SAN should not modify the game")
+	}
+
+	illegal := NewMove(NewPosition(7, 4), NewPosition(5, 4))
+	if san := game.SAN(illegal); san != "e1e3" {
+		t.Errorf("Illegal move should fall back to coordinates, got %s", san)
+	}
+}
+
+func TestParseSANRoundTrip(t *testing.T) {
+	fens := []string{
+		StartFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"6k1/8/8/8/Q6Q/8/8/Q3K3 w - - 0 1",
+	}
+
+	for _, fen := range fens {
+		game, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", fen, err)
+		}
+		for _, move := range game.LegalMoves() {
+			san := game.SAN(move)
+			parsed, err := game.ParseSAN(san)
+			if err != nil {
+				t.Errorf("Failed to parse %s in %q: %v", san, fen, err)
+				continue
+			}
+			if parsed != move {
+				t.Errorf("ParseSAN(%s) = %v, want %v in %q", san, parsed, move, fen)
+			}
+		}
+	}
+}
+
+func TestParseSANErrors(t *testing.T) {
+	game, _ := ParseFEN("4k3/8/8/8/8/2N3N1/8/4K3 w - - 0 1")
+
+	if _, err := game.ParseSAN("Ne2"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous move error, got %v", err)
+	}
+	if _, err := game.ParseSAN("Nb8"); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Expected ErrInvalidMove for unreachable square, got %v", err)
+	}
+	if _, err := game.ParseSAN("O-O"); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Expected ErrInvalidMove for castling without rights, got %v", err)
+	}
+	if _, err := game.ParseSAN("hello"); err == nil {
+		t.Error("Expected error for malformed SAN")
+	}
+
+	game, _ = ParseFEN("4k3/1P6/8/8/8/8/8/4K3 w - - 0 1")
+	if _, err := game.ParseSAN("b8"); !errors.Is(err, ErrPromotionRequired) {
+		t.Errorf("Expected ErrPromotionRequired, got %v", err)
+	}
+	if move, err := game.ParseSAN("b8q"); err != nil || move.Promotion != Queen {
+		t.Errorf("Expected lowercase promotion without '=' to parse, got %v, %v", move, err)
+	}
+}
+
+func TestUndoRestoresPositions(t *testing.T) {
+	game, err := ParseFEN("r3k2r/pPppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	// Castling, capture, double push with en passant reply, promotion with capture
+	sans := []string{"O-O", "hxg2", "a4", "bxa3", "bxa8=Q+", "Bc8", "Kxg2", "O-O"}
+	fens := []string{game.FEN()}
+	for _, san := range sans {
+		move, err := game.ParseSAN(san)
+		if err != nil {
+			t.Fatalf("Failed to parse %s at %s: %v", san, game.FEN(), err)
+		}
+		if err := game.ApplyMove(move); err != nil {
+			t.Fatalf("Failed to apply %s: %v", san, err)
+		}
+		fens = append(fens, game.FEN())
+	}
+
+	for i := len(sans) - 1; i >= 0; i-- {
+		if err := game.UndoMove(); err != nil {
+			t.Fatalf("Undo %d failed: %v", i, err)
+		}
+		if fen := game.FEN(); fen != fens[i] {
+			t.Errorf("After undoing %s expected %q, got %q", sans[i], fens[i], fen)
+		}
+	}
+
+	if err := game.UndoMove(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+
+	for i := range sans {
+		if err := game.RedoMove(); err != nil {
+			t.Fatalf("Redo %d failed: %v", i, err)
+		}
+		if fen := game.FEN(); fen != fens[i+1] {
+			t.Errorf("After redoing %s expected %q, got %q", sans[i], fens[i+1], fen)
+		}
+	}
+
+	if err := game.RedoMove(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+}
+
+func TestUndoRestoresStateAndHistory(t *testing.T) {
+	game := NewGame()
+	moves := [][]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}}
+	for _, move := range moves {
+		game.MakeMove(move[0], move[1])
+	}
+	if game.State != Checkmate {
+		t.Fatalf("Expected checkmate, got %v", game.State)
+	}
+
+	if err := game.UndoMove(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if game.State != Playing || game.CurrentPlayer != Black || len(game.MoveHistory) != 3 {
+		t.Errorf("Undo should restore state, player and history, got %v %v %d", game.State, game.CurrentPlayer, len(game.MoveHistory))
+	}
+
+	queen := game.Board.GetPiece(NewPosition(0, 3)) // d8
+	if queen == nil || queen.Type != Queen || queen.HasMoved {
+		t.Error("Queen should be back on d8 and unmoved")
+	}
+}
+
+func TestNewMoveClearsRedo(t *testing.T) {
+	game := NewGame()
+	game.MakeMove("e2", "e4")
+	game.UndoMove()
+
+	if !game.CanRedo() {
+		t.Fatal("Undone move should be redoable")
+	}
+
+	game.MakeMove("d2", "d4")
+	if game.CanRedo() {
+		t.Error("A new move should discard the redo history")
+	}
+}
+
+func TestRedoAfterGameEnds(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	endings := []struct {
+		name   string
+		end    func(game *Game) error
+		result Result
+	}{
+		{"resignation", func(game *Game) error { return game.Resign(White) }, BlackWins},
+		{"agreement", func(game *Game) error {
+			game.OfferDraw(White)
+			return game.AcceptDraw(Black)
+		}, Drawn},
+		{"claim", func(game *Game) error { return game.ClaimDraw() }, Drawn},
+		{"timeout", func(game *Game) error {
+			ft.Advance(2 * time.Minute)
+			if !game.CheckTime() {
+				return errors.New("no flag fell")
+			}
+			return nil
+		}, WhiteWins},
+	}
+
+	for _, tt := range endings {
+		game := NewGame()
+		game.Clock = NewClock(SuddenDeath(time.Minute), ft.Now)
+		game.Clock.Start(White)
+		// Shuffling twice repeats the start position a third time for the claim
+		playMoves(t, game, "Nf3", "Nf6", "Ng1", "Ng8", "Nf3", "Nf6", "Ng1", "Ng8", "e4")
+		game.UndoMove()
+
+		if err := tt.end(game); err != nil {
+			t.Fatalf("%s: ending the game failed: %v", tt.name, err)
+		}
+		if err := game.RedoMove(); !errors.Is(err, ErrGameOver) || game.CanRedo() {
+			t.Errorf("%s: expected ErrGameOver redoing a move, got %v", tt.name, err)
+		}
+		if game.Result() != tt.result || len(game.MoveHistory) != 8 {
+			t.Errorf("%s: redo should leave the result %s, got %s after %d moves", tt.name, tt.result, game.Result(), len(game.MoveHistory))
+		}
+	}
+}
+
+func TestUndoCastlingRestoresRights(t *testing.T) {
+	game := NewGame()
+	setupCastlingBoard(game)
+
+	game.MakeMove("e1", "g1")
+	game.UndoMove()
+
+	if rights := game.Board.CastlingRights(); rights&WhiteKingSide == 0 {
+		t.Errorf("Undoing castling should restore the right, got %s", rights)
+	}
+	if err := game.MakeMove("e1", "c1"); err != nil {
+		t.Errorf("Queen-side castling should still be possible after undo, got error: %v", err)
+	}
+}
+
+func playMoves(t *testing.T, game *Game, moves ...string) {
+	t.Helper()
+	for _, san := range moves {
+		move, err := game.ParseSAN(san)
+		if err == nil {
+			err = game.ApplyMove(move)
+		}
+		if err != nil {
+			t.Fatalf("Failed to play %s: %v", san, err)
+		}
+	}
+}
+
+func TestRepetitionDraws(t *testing.T) {
+	game := NewGame()
+	shuffle := []string{"Nf3", "Nf6", "Ng1", "Ng8"}
+
+	playMoves(t, game, shuffle...)
+	if reason := game.ClaimableDraw(); reason != NoDraw {
+		t.Errorf("Second occurrence should not allow a claim, got %s", reason)
+	}
+	if err := game.ClaimDraw(); !errors.Is(err, ErrNoDrawToClaim) {
+		t.Errorf("Expected ErrNoDrawToClaim, got %v", err)
+	}
+
+	playMoves(t, game, shuffle...)
+	if reason := game.ClaimableDraw(); reason != ThreefoldRepetition {
+		t.Errorf("Expected threefold repetition claim, got %s", reason)
+	}
+	if game.State != Playing {
+		t.Errorf("Threefold repetition should not end the game by itself, got %s", game.State)
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "may claim a draw by threefold repetition") {
+		t.Errorf("Status should mention the claim, got %q", status)
+	}
+
+	playMoves(t, game, shuffle...)
+	playMoves(t, game, shuffle[:3]...)
+	if game.State != Playing {
+		t.Fatalf("Game should continue before the fifth occurrence, got %s", game.State)
+	}
+	playMoves(t, game, shuffle[3])
+	if game.State != Draw || game.DrawReason != FivefoldRepetition {
+		t.Errorf("Expected fivefold repetition draw, got %s (%s)", game.State, game.DrawReason)
+	}
+	if !game.IsGameOver() {
+		t.Error("Fivefold repetition should end the game")
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "Draw by fivefold repetition") {
+		t.Errorf("Status should give the draw reason, got %q", status)
+	}
+
+	if err := game.UndoMove(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if game.State != Playing || game.DrawReason != NoDraw {
+		t.Errorf("Undo should restore the game in progress, got %s (%s)", game.State, game.DrawReason)
+	}
+}
+
+func TestRepetitionRequiresSameEnPassantRights(t *testing.T) {
+	// Right after ...d5 White may capture exd6 en passant, so that position
+	// differs from its later repetitions with the same pieces
+	game, err := ParseFEN("4k3/3p4/8/4P3/8/8/8/4K1N1 b - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	playMoves(t, game, "d5")
+	playMoves(t, game, "Nf3", "Ke7", "Ng1", "Ke8")
+	playMoves(t, game, "Nf3", "Ke7", "Ng1", "Ke8")
+	if reason := game.ClaimableDraw(); reason != NoDraw {
+		t.Errorf("Position after a double push differs by the en passant right, got %s", reason)
+	}
+
+	playMoves(t, game, "Nf3", "Ke7", "Ng1", "Ke8")
+	if reason := game.ClaimableDraw(); reason != ThreefoldRepetition {
+		t.Errorf("Expected threefold repetition claim, got %s", reason)
+	}
+}
+
+func TestMoveRuleDraws(t *testing.T) {
+	game, err := ParseFEN("4k3/8/8/8/8/8/4P3/R3K3 w - - 99 80")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	if reason := game.ClaimableDraw(); reason != NoDraw {
+		t.Errorf("99 halfmoves should not allow a claim, got %s", reason)
+	}
+
+	playMoves(t, game, "Ra2")
+	if reason := game.ClaimableDraw(); reason != FiftyMoveRule {
+		t.Errorf("Expected fifty-move rule claim, got %s", reason)
+	}
+	if err := game.ClaimDraw(); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if game.State != Draw || game.DrawReason != FiftyMoveRule {
+		t.Errorf("Expected fifty-move rule draw, got %s (%s)", game.State, game.DrawReason)
+	}
+
+	game, err = ParseFEN("4k3/8/8/8/8/8/4P3/R3K3 w - - 149 80")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	playMoves(t, game, "Ra2")
+	if game.State != Draw || game.DrawReason != SeventyFiveMoveRule {
+		t.Errorf("Expected seventy-five-move rule draw, got %s (%s)", game.State, game.DrawReason)
+	}
+
+	// Checkmate on the seventy-fifth move stands
+	game, err = ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 149 80")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	playMoves(t, game, "Ra8#")
+	if game.State != Checkmate {
+		t.Errorf("Checkmate should take precedence over the seventy-five-move rule, got %s", game.State)
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen          string
+		insufficient bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1", true},
+		{"2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1", false}, // bishops on opposite colors
+		{"4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1", true},   // bishops on the same color
+		{"4k3/8/8/8/8/8/8/1NB1K3 w - - 0 1", false},
+		{"1n2k3/8/8/8/8/8/8/1N2K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", false},
+	}
+
+	for _, tt := range tests {
+		game, err := ParseFEN(tt.fen)
+		if err != nil {
+			t.Fatalf("Failed to parse FEN %q: %v", tt.fen, err)
+		}
+		drawn := game.State == Draw && game.DrawReason == InsufficientMaterial
+		if drawn != tt.insufficient {
+			t.Errorf("FEN %q: expected insufficient material %v, got state %s (%s)", tt.fen, tt.insufficient, game.State, game.DrawReason)
+		}
+	}
+
+	// Capturing the last pawn leaves bare kings
+	game, err := ParseFEN("4k3/8/8/8/8/8/3p4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	playMoves(t, game, "Kxd2")
+	if game.State != Draw || game.DrawReason != InsufficientMaterial {
+		t.Errorf("Expected insufficient material draw, got %s (%s)", game.State, game.DrawReason)
+	}
+	if result := game.resultToken(); result != "1/2-1/2" {
+		t.Errorf("Expected draw result, got %s", result)
+	}
+}
+
+func TestResultAndTermination(t *testing.T) {
+	game := NewGame()
+	if game.Result() != NoResult || game.Termination() != Unterminated {
+		t.Errorf("New game should have no result, got %s by %s", game.Result(), game.Termination())
+	}
+
+	playMoves(t, game, "f3", "e5", "g4", "Qh4#")
+	if game.Result() != BlackWins || game.Termination() != ByCheckmate {
+		t.Errorf("Expected 0-1 by checkmate, got %s by %s", game.Result(), game.Termination())
+	}
+
+	tests := []struct {
+		reason      DrawReason
+		termination Termination
+	}{
+		{ThreefoldRepetition, ByRepetition},
+		{FivefoldRepetition, ByRepetition},
+		{FiftyMoveRule, ByMoveRule},
+		{SeventyFiveMoveRule, ByMoveRule},
+		{InsufficientMaterial, ByInsufficientMaterial},
+		{Agreement, ByAgreement},
+	}
+	for _, tt := range tests {
+		game := NewGame()
+		game.State = Draw
+		game.DrawReason = tt.reason
+		if game.Result() != Drawn || game.Termination() != tt.termination {
+			t.Errorf("%s: expected 1/2-1/2 by %s, got %s by %s", tt.reason, tt.termination, game.Result(), game.Termination())
+		}
+	}
+
+	game = NewGame()
+	game.State = Stalemate
+	if game.Result() != Drawn || game.Termination() != ByStalemate {
+		t.Errorf("Expected 1/2-1/2 by stalemate, got %s by %s", game.Result(), game.Termination())
+	}
+}
+
+func TestResign(t *testing.T) {
+	game := NewGame()
+	playMoves(t, game, "e4")
+
+	// Players may resign on the opponent's turn
+	if err := game.Resign(White); err != nil {
+		t.Fatalf("Resign failed: %v", err)
+	}
+	if !game.IsGameOver() || game.State != Resigned {
+		t.Errorf("Resignation should end the game, got %s", game.State)
+	}
+	if game.Result() != BlackWins || game.Termination() != ByResignation {
+		t.Errorf("Expected 0-1 by resignation, got %s by %s", game.Result(), game.Termination())
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "White resigns. Black wins!") || !strings.Contains(status, "Result: 0-1 by resignation") {
+		t.Errorf("Status should describe the resignation, got %q", status)
+	}
+	if !strings.Contains(game.PGN(), "1. e4 0-1") {
+		t.Errorf("PGN should record the result, got %q", game.PGN())
+	}
+
+	if err := game.Resign(Black); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Expected ErrGameOver resigning a finished game, got %v", err)
+	}
+	if err := game.MakeMove("e7", "e5"); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Expected ErrGameOver moving in a finished game, got %v", err)
+	}
+}
+
+func TestDrawOffers(t *testing.T) {
+	game := NewGame()
+
+	if err := game.AcceptDraw(Black); !errors.Is(err, ErrNoDrawOffer) {
+		t.Errorf("Expected ErrNoDrawOffer, got %v", err)
+	}
+
+	// An offer stands while the offering player moves
+	game.OfferDraw(White)
+	playMoves(t, game, "e4")
+	if offerer, ok := game.DrawOffer(); !ok || offerer != White {
+		t.Fatal("White's offer should stand after White moves")
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "White offers a draw") {
+		t.Errorf("Status should mention the offer, got %q", status)
+	}
+
+	// The opponent declines by moving
+	playMoves(t, game, "e5")
+	if _, ok := game.DrawOffer(); ok {
+		t.Error("Moving should decline the opponent's offer")
+	}
+
+	game.OfferDraw(Black)
+	if err := game.DeclineDraw(); err != nil {
+		t.Errorf("Decline failed: %v", err)
+	}
+	if err := game.AcceptDraw(White); !errors.Is(err, ErrNoDrawOffer) {
+		t.Errorf("Declined offer should not be accepted, got %v", err)
+	}
+
+	// Only the opponent of the offering player may accept
+	game.OfferDraw(White)
+	if err := game.AcceptDraw(White); !errors.Is(err, ErrOwnDrawOffer) {
+		t.Errorf("Expected ErrOwnDrawOffer accepting White's own offer, got %v", err)
+	}
+	if _, ok := game.DrawOffer(); !ok || game.State != Playing {
+		t.Error("A rejected acceptance should leave the offer standing")
+	}
+	if err := game.AcceptDraw(Black); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if game.State != Draw || game.Result() != Drawn || game.Termination() != ByAgreement {
+		t.Errorf("Expected 1/2-1/2 by agreement, got %s by %s", game.Result(), game.Termination())
+	}
+	if err := game.OfferDraw(Black); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Expected ErrGameOver offering a draw in a finished game, got %v", err)
+	}
+}
+
+// fakeTime is a time source for clock tests that only moves when told to
+type fakeTime struct {
+	now time.Time
+}
+
+func (ft *fakeTime) Now() time.Time {
+	return ft.now
+}
+
+func (ft *fakeTime) Advance(d time.Duration) {
+	ft.now = ft.now.Add(d)
+}
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TimeControl
+	}{
+		{"5", SuddenDeath(5 * time.Minute)},
+		{"3+2", Fischer(3*time.Minute, 2*time.Second)},
+		{"15d5", Bronstein(15*time.Minute, 5*time.Second)},
+		{"0.5+1", Fischer(30*time.Second, time.Second)},
+		{"40/90+30,30+30", TimeControl{Periods: []TimePeriod{
+			{Moves: 40, Time: 90 * time.Minute, Increment: 30 * time.Second},
+			{Time: 30 * time.Minute, Increment: 30 * time.Second},
+		}}},
+		{"40/120", TimeControl{Periods: []TimePeriod{{Moves: 40, Time: 120 * time.Minute}}}},
+	}
+
+	for _, tt := range tests {
+		control, err := ParseTimeControl(tt.input)
+		if err != nil {
+			t.Errorf("ParseTimeControl(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(control, tt.expected) {
+			t.Errorf("ParseTimeControl(%q) = %+v, expected %+v", tt.input, control, tt.expected)
+		}
+		if control.String() != tt.input {
+			t.Errorf("String() = %q, expected %q", control.String(), tt.input)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "0", "-5", "40/", "x/5", "5+x", "5,3", "5d-1", "NaN", "inf", "-Inf", "5+NaN", "5dInf", "1e300", "5+1e300"} {
+		if _, err := ParseTimeControl(input); err == nil {
+			t.Errorf("ParseTimeControl(%q) should fail", input)
+		}
+	}
+}
+
+func TestClockIncrementAndDelay(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+
+	clock := NewClock(Fischer(time.Minute, 2*time.Second), ft.Now)
+	clock.Start(White)
+	ft.Advance(10 * time.Second)
+	if remaining := clock.Remaining(White); remaining != 50*time.Second {
+		t.Errorf("Expected 50s while thinking, got %v", remaining)
+	}
+	clock.Press()
+	if remaining := clock.Remaining(White); remaining != 52*time.Second {
+		t.Errorf("Expected 52s after the increment, got %v", remaining)
+	}
+	if player, running := clock.Running(); !running || player != Black {
+		t.Error("Pressing should start Black's clock")
+	}
+
+	clock = NewClock(Bronstein(time.Minute, 5*time.Second), ft.Now)
+	clock.Start(White)
+	ft.Advance(3 * time.Second)
+	if remaining := clock.Remaining(White); remaining != 57*time.Second {
+		t.Errorf("The clock should count down during the delay, got %v", remaining)
+	}
+	clock.Press()
+	if remaining := clock.Remaining(White); remaining != time.Minute {
+		t.Errorf("Time within the delay should be given back, got %v", remaining)
+	}
+	clock.Press()
+	ft.Advance(8 * time.Second)
+	clock.Press()
+	if remaining := clock.Remaining(White); remaining != 57*time.Second {
+		t.Errorf("Only time beyond the delay should count, got %v", remaining)
+	}
+}
+
+func TestClockFlagFallsWithinDelay(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	clock := NewClock(Bronstein(2*time.Second, 5*time.Second), ft.Now)
+	clock.Start(White)
+
+	// The delay is only given back for a move made in time
+	ft.Advance(3 * time.Second)
+	if player, flagged := clock.Flagged(); !flagged || player != White {
+		t.Error("White's flag should fall within the delay")
+	}
+	if ok, _ := clock.Press(); ok {
+		t.Error("Pressing after the flag fell should fail")
+	}
+	if remaining := clock.Remaining(White); remaining != 0 {
+		t.Errorf("No time should be given back after the flag fell, got %v", remaining)
+	}
+}
+
+func TestClockPeriods(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	control, _ := ParseTimeControl("2/1,1/0.5")
+	clock := NewClock(control, ft.Now)
+	clock.Start(White)
+
+	for move := 0; move < 2; move++ {
+		if togo := clock.MovesToGo(White); togo != 2-move {
+			t.Errorf("Expected %d moves to go, got %d", 2-move, togo)
+		}
+		ft.Advance(10 * time.Second)
+		clock.Press()
+		clock.Press()
+	}
+
+	// 60s - 20s used + 30s for the second period
+	if remaining := clock.Remaining(White); remaining != 70*time.Second {
+		t.Errorf("Expected the next period's time to be added, got %v", remaining)
+	}
+
+	// The last period repeats because it has a move count
+	ft.Advance(10 * time.Second)
+	clock.Press()
+	if remaining := clock.Remaining(White); remaining != 90*time.Second {
+		t.Errorf("Expected the last period to repeat, got %v", remaining)
+	}
+}
+
+func TestGameClockFlagFall(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	game := NewGame()
+	game.Clock = NewClock(SuddenDeath(time.Minute), ft.Now)
+	game.Clock.Start(White)
+
+	ft.Advance(20 * time.Second)
+	playMoves(t, game, "e4")
+	if remaining := game.Clock.Remaining(White); remaining != 40*time.Second {
+		t.Errorf("Moving should press the clock, got %v for White", remaining)
+	}
+
+	ft.Advance(time.Minute)
+	if err := game.MakeMove("e7", "e5"); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Expected ErrGameOver after the flag fell, got %v", err)
+	}
+	if game.State != TimeForfeit || game.Result() != WhiteWins || game.Termination() != ByTimeout {
+		t.Errorf("Expected 1-0 by timeout, got %s by %s", game.Result(), game.Termination())
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "Black ran out of time. White wins!") {
+		t.Errorf("Status should describe the timeout, got %q", status)
+	}
+	if _, running := game.Clock.Running(); running {
+		t.Error("The clock should stop when the game ends")
+	}
+}
+
+func TestTimeoutAgainstInsufficientMaterial(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	game, err := ParseFEN("4k3/8/8/8/8/8/3PP3/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+	game.Clock = NewClock(SuddenDeath(time.Minute), ft.Now)
+	game.Clock.Start(White)
+
+	ft.Advance(2 * time.Minute)
+	if !game.CheckTime() {
+		t.Fatal("White's flag should have fallen")
+	}
+	if game.Result() != Drawn || game.Termination() != ByTimeout {
+		t.Errorf("A bare king cannot win on time, expected 1/2-1/2 by timeout, got %s by %s", game.Result(), game.Termination())
+	}
+	if status := game.GetGameStatus(); !strings.Contains(status, "cannot checkmate") {
+		t.Errorf("Status should explain the draw, got %q", status)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		90 * time.Minute:                     "1:30:00",
+		5*time.Minute + 7*time.Second:        "5:07",
+		10 * time.Second:                     "0:10",
+		9*time.Second + 450*time.Millisecond: "9.4",
+		-time.Second:                         "0.0",
+	}
+	for d, expected := range tests {
+		if got := FormatDuration(d); got != expected {
+			t.Errorf("FormatDuration(%v) = %q, expected %q", d, got, expected)
+		}
+	}
+}
+
+func TestPerft(t *testing.T) {
+	// Deeper counts take seconds each and are left to the perft command
+	const maxNodes = 100000
+
+	for _, position := range PerftPositions {
+		game, err := ParseFEN(position.FEN)
+		if err != nil {
+			t.Fatalf("%s: failed to parse FEN: %v", position.Name, err)
+		}
+
+		for depth, expected := range position.Nodes {
+			if expected > maxNodes {
+				break
+			}
+			if nodes := game.Perft(depth + 1); nodes != expected {
+				t.Errorf("%s: perft(%d) = %d, expected %d", position.Name, depth+1, nodes, expected)
+			}
+		}
+
+		if fen := game.FEN(); fen != position.FEN {
+			t.Errorf("%s: perft should leave the position unchanged, got %q", position.Name, fen)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	game := NewGame()
+	counts := game.Divide(2)
+
+	if len(counts) != 20 {
+		t.Fatalf("Expected 20 moves, got %d", len(counts))
+	}
+	for move, nodes := range counts {
+		if nodes != 20 {
+			t.Errorf("Expected 20 replies to %s, got %d", move, nodes)
+		}
+	}
+
+	game, _ = ParseFEN(PerftPositions[1].FEN)
+	if nodes := game.Divide(1)[NewMove(NewPosition(7, 4), NewPosition(7, 6))]; nodes != 1 {
+		t.Errorf("Kiwipete should include castling e1g1 once, got %d", nodes)
+	}
+}
+
+func TestAttackTables(t *testing.T) {
+	a1 := squareIndex(NewPosition(7, 0))
+	d4 := squareIndex(NewPosition(4, 3))
+
+	if count := knightAttacks[a1].count(); count != 2 {
+		t.Errorf("Knight on a1 should attack 2 squares, got %d", count)
+	}
+	if count := knightAttacks[d4].count(); count != 8 {
+		t.Errorf("Knight on d4 should attack 8 squares, got %d", count)
+	}
+	if count := kingAttacks[a1].count(); count != 3 {
+		t.Errorf("King on a1 should attack 3 squares, got %d", count)
+	}
+	if count := rookAttacks(d4, 0).count(); count != 14 {
+		t.Errorf("Rook on an empty board should attack 14 squares, got %d", count)
+	}
+	if count := bishopAttacks(d4, 0).count(); count != 13 {
+		t.Errorf("Bishop on d4 on an empty board should attack 13 squares, got %d", count)
+	}
+
+	// Blockers are attacked but end the ray, in both directions along a line
+	d6 := squareIndex(NewPosition(2, 3))
+	d2 := squareIndex(NewPosition(6, 3))
+	d7 := squareIndex(NewPosition(1, 3))
+	d1 := squareIndex(NewPosition(7, 3))
+	attacks := rookAttacks(d4, squareBit(d6)|squareBit(d2))
+	if !attacks.has(d6) || !attacks.has(d2) || attacks.has(d7) || attacks.has(d1) {
+		t.Error("Rook attacks should stop at the first blocker on each ray")
+	}
+
+	e5 := squareIndex(NewPosition(3, 4))
+	if !pawnAttacks[White][d4].has(squareIndex(NewPosition(3, 2))) || !pawnAttacks[White][d4].has(e5) {
+		t.Error("White pawn on d4 should attack c5 and e5")
+	}
+	if !pawnAttacks[Black][e5].has(d4) {
+		t.Error("Black pawn on e5 should attack d4")
+	}
+}
+
+func TestBitboardsFollowSquares(t *testing.T) {
+	game, err := ParseFEN(PerftPositions[1].FEN)
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	check := func(context string) {
+		t.Helper()
+		var pieces [2][6]bitboard
+		for row := 0; row < 8; row++ {
+			for col := 0; col < 8; col++ {
+				if piece := game.Board.GetPiece(NewPosition(row, col)); piece != nil {
+					pieces[piece.Color][piece.Type] |= squareBit(squareIndex(NewPosition(row, col)))
+				}
+			}
+		}
+		if pieces != game.Board.pieces {
+			t.Errorf("%s: bitboards do not match the squares", context)
+		}
+		for _, color := range []Color{White, Black} {
+			var all bitboard
+			for _, bb := range pieces[color] {
+				all |= bb
+			}
+			if all != game.Board.colors[color] {
+				t.Errorf("%s: %s occupancy does not match the squares", context, color)
+			}
+		}
+	}
+
+	// Kiwipete's first two plies include castling, captures and en passant
+	for _, move := range game.LegalMoves() {
+		game.ApplyMove(move)
+		check("after " + move.String())
+		for _, reply := range game.LegalMoves() {
+			game.ApplyMove(reply)
+			check("after " + move.String() + " " + reply.String())
+			game.UndoMove()
+		}
+		game.UndoMove()
+		check("after undoing " + move.String())
+	}
+}
+
+func TestHashTranspositions(t *testing.T) {
+	first := NewGame()
+	playMoves(t, first, "Nf3", "Nf6", "Nc3")
+	second := NewGame()
+	playMoves(t, second, "Nc3", "Nf6", "Nf3")
+
+	if first.Hash() != second.Hash() {
+		t.Error("Transposed move orders should reach the same hash")
+	}
+
+	start := NewGame().Hash()
+	playMoves(t, first, "Ng8", "Nb1", "Nf6", "Ng1", "Ng8")
+	if first.Hash() != start {
+		t.Error("Returning to the start position should restore its hash")
+	}
+	playMoves(t, first, "Nf3")
+	for first.CanUndo() {
+		first.UndoMove()
+	}
+	if first.Hash() != start {
+		t.Error("Undoing every move should restore the start hash")
+	}
+}
+
+func TestHashDistinguishesState(t *testing.T) {
+	hashOf := func(fen string) uint64 {
+		t.Helper()
+		game, err := ParseFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to parse FEN %q: %v", fen, err)
+		}
+		return game.Hash()
+	}
+
+	base := hashOf("r3k2r/8/8/3pP3/8/8/8/R3K2R w KQkq - 0 1")
+	others := map[string]string{
+		"side to move":    "r3k2r/8/8/3pP3/8/8/8/R3K2R b KQkq - 0 1",
+		"castling rights": "r3k2r/8/8/3pP3/8/8/8/R3K2R w Kkq - 0 1",
+		"en passant":      "r3k2r/8/8/3pP3/8/8/8/R3K2R w KQkq d6 0 1",
+	}
+	for name, fen := range others {
+		if hashOf(fen) == base {
+			t.Errorf("Hash should depend on the %s", name)
+		}
+	}
+
+	// A double push without an enemy pawn beside it leaves no en passant capture
+	if hashOf("4k3/8/8/8/3P4/8/8/4K3 b - d3 0 1") != hashOf("4k3/8/8/8/3P4/8/8/4K3 b - - 0 1") {
+		t.Error("An en passant square without a possible capture should not change the hash")
+	}
+
+	// The clocks are not part of the position
+	if hashOf("r3k2r/8/8/3pP3/8/8/8/R3K2R w KQkq - 12 40") != base {
+		t.Error("Move counters should not change the hash")
+	}
+}
+
+func TestHashMatchesFreshPosition(t *testing.T) {
+	game, err := ParseFEN(PerftPositions[1].FEN)
+	if err != nil {
+		t.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	// The incrementally updated hash must equal the hash of the same position set up from scratch
+	for _, move := range game.LegalMoves() {
+		game.ApplyMove(move)
+		fresh, err := ParseFEN(game.FEN())
+		if err != nil {
+			t.Fatalf("Failed to parse FEN after %s: %v", move, err)
+		}
+		if game.Hash() != fresh.Hash() {
+			t.Errorf("Hash after %s differs from a fresh parse of %q", move, game.FEN())
+		}
+		game.UndoMove()
+	}
+
+	if game.Hash() != mustParseFEN(t, PerftPositions[1].FEN).Hash() {
+		t.Error("Undo should restore the original hash")
+	}
+}
+
+func mustParseFEN(t *testing.T, fen string) *Game {
+	t.Helper()
+	game, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatalf("Failed to parse FEN %q: %v", fen, err)
+	}
+	return game
+}
+
+func TestMakeUnmakeRestoresGame(t *testing.T) {
+	game := mustParseFEN(t, PerftPositions[1].FEN)
+	game.OfferDraw(White)
+	fen, hash := game.FEN(), game.Hash()
+
+	// Walk two plies deep and check every take-back restores the game exactly
+	for _, move := range game.LegalMoves() {
+		game.makeMove(move)
+		for _, reply := range game.LegalMoves() {
+			game.makeMove(reply)
+			game.unmakeLastMove()
+		}
+		game.unmakeLastMove()
+
+		if game.FEN() != fen || game.Hash() != hash {
+			t.Fatalf("Position after taking back %s is %q, want %q", move, game.FEN(), fen)
+		}
+		if offerer, ok := game.DrawOffer(); !ok || offerer != White || game.State != Playing || len(game.MoveHistory) != 0 {
+			t.Fatalf("Game state after taking back %s was not restored", move)
+		}
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Move
+	}{
+		{"e2e4", NewMove(NewPosition(6, 4), NewPosition(4, 4))},
+		{"e7e8q", NewPromotionMove(NewPosition(1, 4), NewPosition(0, 4), Queen)},
+		{"a2a1n", NewPromotionMove(NewPosition(6, 0), NewPosition(7, 0), Knight)},
+	}
+	for _, tt := range tests {
+		move, err := ParseMove(tt.input)
+		if err != nil || move != tt.want {
+			t.Errorf("ParseMove(%q) = %v, %v; want %v", tt.input, move, err, tt.want)
+		}
+		if move.String() != tt.input {
+			t.Errorf("ParseMove(%q).String() = %q", tt.input, move.String())
+		}
+	}
+
+	for _, input := range []string{"", "e2", "e2e9", "i2e4", "e7e8k", "e2e4qq"} {
+		if _, err := ParseMove(input); err == nil {
+			t.Errorf("ParseMove(%q) should fail", input)
+		}
+	}
+}
+
+func TestSearchCancelled(t *testing.T) {
+	game := NewGame()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A search cancelled before it starts still returns a legal move, quickly
+	ai := NewAI(White, 3)
+	start := time.Now()
+	result, ok := ai.Search(ctx, game, Limits{})
+	if !ok || !game.IsLegal(result.Move) {
+		t.Fatalf("Expected a legal move from a cancelled search, got %v, %v", result.Move, ok)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Cancelled search took %v", elapsed)
+	}
+	if len(game.MoveHistory) != 0 || game.FEN() != StartFEN {
+		t.Error("Search should leave the game unchanged")
+	}
+}
+
+func TestSearchReportsIterations(t *testing.T) {
+	game := NewGame()
+	ai := NewAI(White, 3)
+
+	var depths []int
+	var last SearchResult
+	ai.OnIteration(func(info SearchResult) {
+		depths = append(depths, info.Depth)
+		last = info
+	})
+	result, _ := ai.Search(context.Background(), game, Limits{Depth: 3})
+
+	if !reflect.DeepEqual(depths, []int{1, 2, 3}) {
+		t.Errorf("Expected one report per depth, got %v", depths)
+	}
+	// The result is the deepest iteration's, whether or not it scored higher
+	last.Time = result.Time
+	if !reflect.DeepEqual(last, result) || result.Nodes != ai.Nodes() {
+		t.Errorf("Last report %+v should match the result %+v and %d nodes", last, result, ai.Nodes())
+	}
+	if _, ok := last.MateIn(); ok {
+		t.Errorf("No mate should be reported from the start position, got score %v", last.Score)
+	}
+}
+
+func TestSearchStopsAtMate(t *testing.T) {
+	game := mustParseFEN(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	ai := NewAI(White, 5)
+
+	var depths []int
+	var last SearchResult
+	ai.OnIteration(func(info SearchResult) {
+		depths = append(depths, info.Depth)
+		last = info
+	})
+	result, _ := ai.Search(context.Background(), game, Limits{})
+
+	// Without any limit the search ends because deeper search cannot beat mate in one
+	if result.Move.String() != "a1a8" || !reflect.DeepEqual(depths, []int{1}) {
+		t.Errorf("Expected a1a8 after one iteration, got %v after %v", result.Move, depths)
+	}
+	if moves, ok := last.MateIn(); !ok || moves != 1 {
+		t.Errorf("Expected mate in 1, got %d, %v (score %v)", moves, ok, last.Score)
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	game := NewGame()
+
+	ai := NewAI(White, 3)
+	var depths []int
+	ai.OnIteration(func(info SearchResult) {
+		depths = append(depths, info.Depth)
+		if info.Nodes > 2000 {
+			t.Errorf("Iteration %d completed after %d nodes, past the limit", info.Depth, info.Nodes)
+		}
+	})
+	if result, ok := ai.Search(context.Background(), game, Limits{Nodes: 2000}); !ok || !game.IsLegal(result.Move) {
+		t.Fatalf("Expected a legal move within the node limit, got %v, %v", result.Move, ok)
+	}
+	if len(depths) == 0 || ai.Nodes() > 2000 {
+		t.Errorf("Expected completed iterations within 2000 nodes, got %v after %d nodes", depths, ai.Nodes())
+	}
+
+	ai = NewAI(White, 3)
+	start := time.Now()
+	if result, ok := ai.Search(context.Background(), game, Limits{MoveTime: 100 * time.Millisecond}); !ok || !game.IsLegal(result.Move) {
+		t.Fatalf("Expected a legal move within the move time, got %v, %v", result.Move, ok)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Search with a 100ms move time took %v", elapsed)
+	}
+}
+
+func TestLimitsBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   time.Duration
+	}{
+		{"no limit", Limits{Depth: 5}, 0},
+		{"move time", Limits{MoveTime: time.Second, Time: time.Minute}, time.Second},
+		{"sudden death", Limits{Time: 3 * time.Minute}, 6 * time.Second},
+		{"moves to go and increment", Limits{Time: 30 * time.Second, Increment: 500 * time.Millisecond, MovesToGo: 20}, 1875 * time.Millisecond},
+		{"half the clock at most", Limits{Time: time.Second, Increment: 5 * time.Second}, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.limits.budget(); got != tt.want {
+			t.Errorf("%s: budget %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClockLimits(t *testing.T) {
+	ft := &fakeTime{now: time.Unix(0, 0)}
+	control, _ := ParseTimeControl("40/90+30,30d5")
+	clock := NewClock(control, ft.Now)
+	clock.Start(White)
+	ft.Advance(10 * time.Second)
+
+	want := Limits{Time: 90*time.Minute - 10*time.Second, Increment: 30 * time.Second, MovesToGo: 40}
+	if got := clock.Limits(White); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSearchScoresRepetitionsAsDraws(t *testing.T) {
+	const fen = "4k3/8/8/8/8/8/8/Q3K3 w - - 0 1"
+	shuffle := []string{"Kd1", "Kd8", "Ke1", "Ke8"}
+
+	// searchFrom searches the position at the given ply of a search that
+	// started at the root position of the game's history
+	searchFrom := func(game *Game, root, ply int) float64 {
+		ai := NewAI(White, 2)
+		ai.SetTranspositionTable(NewTranspositionTable(1))
+		ai.rootPosition = root
+		return ai.negamax(game, 2, math.Inf(-1), math.Inf(1), ply, true)
+	}
+
+	// Returning to the root within the search is a draw, however far
+	// White is ahead
+	game := mustParseFEN(t, fen)
+	playMoves(t, game, shuffle...)
+	if score := searchFrom(game, 0, 4); score != 0 {
+		t.Errorf("A repetition within the search should score 0, got %v", score)
+	}
+
+	// A position first seen before the search is only drawn on its third
+	// occurrence
+	game = mustParseFEN(t, fen)
+	playMoves(t, game, shuffle[:3]...)
+	root := len(game.positionHashes) - 1
+	playMoves(t, game, shuffle[3])
+	if game.repeats(root) || searchFrom(game, root, 1) <= 0 {
+		t.Error("A second occurrence from before the search should not be a draw")
+	}
+
+	game = mustParseFEN(t, fen)
+	playMoves(t, game, shuffle...)
+	playMoves(t, game, shuffle[:3]...)
+	root = len(game.positionHashes) - 1
+	playMoves(t, game, shuffle[3])
+	if !game.repeats(root) || searchFrom(game, root, 1) != 0 {
+		t.Error("A threefold repetition should score 0")
+	}
+}
+
+func TestSearchPrincipalVariation(t *testing.T) {
+	for _, position := range PerftPositions[:4] {
+		game := mustParseFEN(t, position.FEN)
+		result, ok := NewAI(game.CurrentPlayer, 4).Search(context.Background(), game, Limits{Depth: 4})
+		if !ok {
+			t.Fatalf("%s: no move found", position.Name)
+		}
+
+		// The variation is a legal line of at least the full depth, longer
+		// where checks extend it, starting with the move
+		if len(result.PV) < 4 || result.PV[0] != result.Move || result.Depth != 4 {
+			t.Errorf("%s: expected a PV of 4 or more moves starting with %v, got %v at depth %d",
+				position.Name, result.Move, result.PV, result.Depth)
+		}
+		line := game.clone()
+		for _, move := range result.PV {
+			if err := line.ApplyMove(move); err != nil {
+				t.Fatalf("%s: PV %v has illegal move %v: %v", position.Name, result.PV, move, err)
+			}
+		}
+	}
+}
+
+func TestAspirationSearchMatchesFullWindow(t *testing.T) {
+	// Delta pruning in quiescence search depends on the window, so Kiwipete,
+	// full of captures, is left out
+	for _, position := range []PerftPosition{PerftPositions[0], PerftPositions[2], PerftPositions[3]} {
+		game := mustParseFEN(t, position.FEN)
+		for depth := 1; depth <= 3; depth++ {
+			// Searching with and without a window must agree on the score.
+			// Selective pruning also depends on the window, so it is left out.
+			ai := NewAI(game.CurrentPlayer, depth)
+			ai.SetOptions(SearchOptions{})
+			ai.SetTranspositionTable(NewTranspositionTable(1))
+			want := ai.negamax(game.clone(), depth, math.Inf(-1), math.Inf(1), 0, true)
+
+			ai = NewAI(game.CurrentPlayer, depth)
+			ai.SetOptions(SearchOptions{})
+			ai.SetTranspositionTable(NewTranspositionTable(1))
+			got := ai.aspirationSearch(game.clone(), depth, want+3*aspirationWindow)
+			if math.Abs(got-want) > 1e-9 {
+				t.Errorf("%s depth %d: aspiration search scores %v, full window %v", position.Name, depth, got, want)
+			}
+		}
+	}
+}
+
+func TestNullWindowNodesUseTable(t *testing.T) {
+	game := NewGame()
+	game.MakeMove("e2", "e4")
+
+	// A null window off the principal variation takes the table's cutoff
+	// whatever rounding does to its width
+	cutoffs := 0
+	for i := 0; i < 1000; i++ {
+		alpha := float64(i)*0.0137 - 7
+		ai := NewAI(White, 4)
+		ai.SetTranspositionTable(NewTranspositionTable(1))
+		ai.transpositionTable.store(game.Hash(), TranspositionEntry{depth: 4, score: 0.25, flag: 0})
+		if score := ai.negamax(game, 4, alpha, alpha+nullWindow, 1, false); score == 0.25 && ai.nodes == 1 {
+			cutoffs++
+		}
+	}
+	if cutoffs != 1000 {
+		t.Errorf("Expected every null window search to cut off on the table, got %d of 1000", cutoffs)
+	}
+}
+
+func TestNullMove(t *testing.T) {
+	game := mustParseFEN(t, "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3")
+	fen, hash := game.FEN(), game.Hash()
+
+	enPassantTarget := game.makeNullMove()
+	if game.CurrentPlayer != Black || game.EnPassantTarget != nil || game.Hash() == hash {
+		t.Errorf("A null move should pass the move and clear en passant, got %s", game.FEN())
+	}
+	game.unmakeNullMove(enPassantTarget)
+	if game.FEN() != fen || game.Hash() != hash {
+		t.Errorf("Expected %s after taking back the null move, got %s", fen, game.FEN())
+	}
+
+	// Null moves are not tried by a side with only pawns, where zugzwang is common
+	pawnEnding := mustParseFEN(t, "8/8/4k3/4p3/4P3/4K3/8/8 w - - 0 1")
+	if hasPieces(pawnEnding, White) || !hasPieces(game, White) {
+		t.Error("Only a side with pieces besides pawns should try null moves")
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	if options := NewAI(White, 4).Options(); options != DefaultSearchOptions() {
+		t.Errorf("A new AI should use the default options, got %+v", options)
+	}
+
+	// Every technique must leave the AI playing soundly when used alone
+	for name, options := range map[string]SearchOptions{
+		"none":                 {},
+		"null move":            {NullMove: true},
+		"late move reductions": {LateMoveReductions: true},
+		"futility":             {Futility: true},
+		"reverse futility":     {ReverseFutility: true},
+		"check extensions":     {CheckExtensions: true},
+	} {
+		for _, tt := range tacticalPositions {
+			game := mustParseFEN(t, tt.fen)
+			ai := NewAI(game.CurrentPlayer, 3)
+			ai.SetOptions(options)
+			move, _ := ai.BestMove(game)
+
+			if san := game.SAN(move); san == tt.avoid || (tt.play != "" && san != tt.play) {
+				t.Errorf("%s: %s plays %s", name, tt.name, san)
+			}
+		}
+	}
+}
+
+func TestSelectiveSearch(t *testing.T) {
+	game := mustParseFEN(t, PerftPositions[1].FEN)
+	search := func(options SearchOptions) SearchResult {
+		ai := NewAI(White, 4)
+		ai.SetOptions(options)
+		result, _ := ai.Search(context.Background(), game, Limits{Depth: 4})
+		return result
+	}
+
+	// Pruning and reductions let the search visit far fewer positions
+	full, selective := search(SearchOptions{}), search(DefaultSearchOptions())
+	if selective.Nodes*2 > full.Nodes {
+		t.Errorf("Expected the selective search to need less than half of %d nodes, got %d", full.Nodes, selective.Nodes)
+	}
+
+	// Check extensions follow forcing lines past the nominal depth
+	game = mustParseFEN(t, PerftPositions[2].FEN)
+	ai := NewAI(game.CurrentPlayer, 4)
+	ai.SetOptions(SearchOptions{CheckExtensions: true})
+	extended, _ := ai.Search(context.Background(), game, Limits{Depth: 4})
+	ai.SetOptions(SearchOptions{})
+	plain, _ := ai.Search(context.Background(), game, Limits{Depth: 4})
+	if len(plain.PV) != 4 || len(extended.PV) <= 4 {
+		t.Errorf("Expected check extensions to lengthen the PV, got %v without and %v with", plain.PV, extended.PV)
+	}
+}
+
+func TestParallelSearch(t *testing.T) {
+	for _, tt := range tacticalPositions {
+		game := mustParseFEN(t, tt.fen)
+		ai := NewAI(game.CurrentPlayer, 4)
+		ai.SetThreads(4)
+		result, ok := ai.Search(context.Background(), game, Limits{Depth: 4})
+		if !ok || result.Depth != 4 {
+			t.Fatalf("%s: expected a result at depth 4, got %+v", tt.name, result)
+		}
+
+		if san := game.SAN(result.Move); san == tt.avoid || (tt.play != "" && san != tt.play) {
+			t.Errorf("%s: parallel search plays %s", tt.name, san)
+		}
+		if game.FEN() != mustParseFEN(t, tt.fen).FEN() {
+			t.Errorf("%s: search should leave the game unchanged", tt.name)
+		}
+	}
+
+	// The node limit counts the positions of every thread
+	game := NewGame()
+	ai := NewAI(White, 4)
+	ai.SetThreads(4)
+	if _, ok := ai.Search(context.Background(), game, Limits{Nodes: 20000}); !ok || ai.Nodes() > 20000+4*1024 {
+		t.Errorf("Expected about 20000 nodes over all threads, got %d", ai.Nodes())
+	}
+}
+
+func TestSingleThreadSearchIsDeterministic(t *testing.T) {
+	game := mustParseFEN(t, PerftPositions[1].FEN)
+	first, _ := NewAI(White, 4).Search(context.Background(), game, Limits{Depth: 4})
+	second, _ := NewAI(White, 4).Search(context.Background(), game, Limits{Depth: 4})
+
+	first.Time, second.Time = 0, 0
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Two single thread searches differ: %+v and %+v", first, second)
+	}
+}
+
+func TestTranspositionTable(t *testing.T) {
+	table := NewTranspositionTable(1)
+	if len(table.buckets) != 1<<15 {
+		t.Errorf("Expected 1 MB to hold %d buckets, got %d", 1<<15, len(table.buckets))
+	}
+	if _, ok := table.probe(0); ok {
+		t.Error("An empty table should hold no entry, even for hash 0")
+	}
+
+	move := Move{From: NewPosition(1, 4), To: NewPosition(0, 4), Promotion: Queen}
+	entry := TranspositionEntry{depth: 7, score: -mateScore + 3, flag: 1, move: move}
+	table.store(0x1234, entry)
+	if got, ok := table.probe(0x1234); !ok || got != entry {
+		t.Errorf("Expected %+v, got %+v, %v", entry, got, ok)
+	}
+
+	// An entry without a best move keeps the one known for the position
+	table.store(0x1234, TranspositionEntry{depth: 8, score: 0.5, flag: 2})
+	if got, _ := table.probe(0x1234); got.move != move || got.depth != 8 {
+		t.Errorf("Expected the new entry with the old move, got %+v", got)
+	}
+}
+
+func TestTranspositionTableReplacement(t *testing.T) {
+	table := NewTranspositionTable(1)
+	table.newSearch()
+	buckets := uint64(len(table.buckets))
+	deep, shallow, newer := uint64(5), 5+buckets, 5+2*buckets
+
+	// A shallower result for another position in the bucket goes to the
+	// always-replace slot and leaves the deep one
+	table.store(deep, TranspositionEntry{depth: 6})
+	table.store(shallow, TranspositionEntry{depth: 2})
+	if _, ok := table.probe(deep); !ok {
+		t.Error("The deep entry should be kept")
+	}
+	if _, ok := table.probe(shallow); !ok {
+		t.Error("The shallow entry should be stored")
+	}
+	table.store(newer, TranspositionEntry{depth: 1})
+	if _, ok := table.probe(shallow); ok {
+		t.Error("The newest entry should replace the shallow one")
+	}
+	if _, ok := table.probe(deep); !ok {
+		t.Error("The deep entry should survive newer shallow ones")
+	}
+
+	// In a new search the deep entry of the last one gives way
+	table.newSearch()
+	table.store(shallow, TranspositionEntry{depth: 1})
+	if _, ok := table.probe(deep); ok {
+		t.Error("An entry of an earlier search should be replaced first")
+	}
+}
+
+func TestHashfull(t *testing.T) {
+	table := NewTranspositionTable(1)
+	if got := table.Hashfull(); got != 0 {
+		t.Errorf("An empty table should be 0 permille full, got %d", got)
+	}
+
+	ai := NewAI(White, 4)
+	ai.SetTranspositionTable(table)
+	ai.BestMove(mustParseFEN(t, PerftPositions[1].FEN))
+	if got := table.Hashfull(); got <= 0 || got > 1000 {
+		t.Errorf("Expected the table to fill during a search, got %d permille", got)
+	}
+
+	// Entries of an earlier search no longer count
+	table.newSearch()
+	if got := table.Hashfull(); got != 0 {
+		t.Errorf("A new search should start with 0 permille, got %d", got)
+	}
+
+	table.Clear()
+	if _, ok := table.probe(mustParseFEN(t, PerftPositions[1].FEN).Hash()); ok {
+		t.Error("Clear should remove every entry")
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	game := NewGame()
+	ai := NewAI(White, 3)
+	ai.SetMultiPV(3)
+	result, _ := ai.Search(context.Background(), game, Limits{Depth: 3})
+
+	if len(result.Lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %+v", result.Lines)
+	}
+	if result.Lines[0].Score != result.Score || !reflect.DeepEqual(result.Lines[0].PV, result.PV) {
+		t.Errorf("The first line %+v should be the result's", result.Lines[0])
+	}
+	seen := make(map[Move]bool)
+	for i, line := range result.Lines {
+		if len(line.PV) == 0 || seen[line.PV[0]] {
+			t.Errorf("Line %d should start with a new move, got %v", i+1, line.PV)
+			continue
+		}
+		seen[line.PV[0]] = true
+		if i > 0 && line.Score > result.Lines[i-1].Score {
+			t.Errorf("Lines should be ranked best first, got %+v", result.Lines)
+		}
+		if sans := game.SANLine(line.PV); len(sans) != len(line.PV) {
+			t.Errorf("Line %d has an illegal move: %v", i+1, line.PV)
+		}
+	}
+
+	// The mate comes first, and the search goes on to rank the other line
+	game = mustParseFEN(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	ai = NewAI(White, 2)
+	ai.SetMultiPV(2)
+	result, _ = ai.Search(context.Background(), game, Limits{Depth: 2})
+	if moves, ok := result.Lines[0].MateIn(); !ok || moves != 1 || result.Move.String() != "a1a8" {
+		t.Errorf("Expected a1a8 mating first, got %+v", result.Lines[0])
+	}
+	if _, ok := result.Lines[1].MateIn(); len(result.Lines) != 2 || ok || result.Depth != 2 {
+		t.Errorf("Expected a second line without mate at depth 2, got %+v at depth %d", result.Lines, result.Depth)
+	}
+
+	// There are never more lines than legal moves
+	game = mustParseFEN(t, "7k/8/8/8/8/8/8/K7 w - - 0 1")
+	ai = NewAI(White, 2)
+	ai.SetMultiPV(5)
+	if result, _ := ai.Search(context.Background(), game, Limits{Depth: 2}); len(result.Lines) != 3 {
+		t.Errorf("Expected a line for each of the 3 legal moves, got %d", len(result.Lines))
+	}
+}
+
+func TestSANLine(t *testing.T) {
+	game := NewGame()
+	moves := []Move{
+		NewMove(NewPosition(6, 4), NewPosition(4, 4)),
+		NewMove(NewPosition(1, 4), NewPosition(3, 4)),
+		NewMove(NewPosition(7, 6), NewPosition(5, 5)),
+	}
+	if got := game.SANLine(moves); !reflect.DeepEqual(got, []string{"e4", "e5", "Nf3"}) {
+		t.Errorf("Expected e4 e5 Nf3, got %v", got)
+	}
+
+	// The line stops at an illegal move
+	if got := game.SANLine([]Move{moves[0], moves[0]}); !reflect.DeepEqual(got, []string{"e4"}) {
+		t.Errorf("Expected the line to stop after e4, got %v", got)
+	}
+	if game.FEN() != StartFEN {
+		t.Error("SANLine should leave the game unchanged")
+	}
+}
+
+// tacticalPositions are positions where evaluating the leaves of the search in
+// the middle of an exchange made the AI take a defended piece and lose material
+var tacticalPositions = []struct {
+	name  string
+	fen   string
+	avoid string // the losing capture, in SAN
+	play  string // the winning move, in SAN, if there is a clear one
+}{
+	{"queen takes pawn defended by pawn", "4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1", "Qxd5", ""},
+	{"knight takes pawn defended by pawn", "4k3/8/2p5/3p4/8/4N3/8/4K3 w - - 0 1", "Nxd5", ""},
+	{"rook takes pawn defended twice", "3rk3/3r4/8/3p4/8/8/3R4/3RK3 w - - 0 1", "Rxd5", ""},
+	{"queen takes pawn defended by knight", "4k3/8/5n2/3p4/8/2N5/8/3QK3 w - - 0 1", "Qxd5", ""},
+	{"knight takes pawn defended by knight", "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", "Nxe5", ""},
+	{"queen takes knight defended by rook", "2r1k3/8/8/2n5/8/2Q5/8/4K3 w - - 0 1", "Qxc5", ""},
+	{"knight wins the queen", "rnb1kbnr/pppp1ppp/8/4p3/4P2q/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", "", "Nxh4"},
+	{"knight takes free pawn", "4k3/8/8/3n4/8/2P5/8/3RK3 b - - 0 1", "", "Nxc3"},
+}
+
+func TestTacticalPositions(t *testing.T) {
+	for _, tt := range tacticalPositions {
+		for depth := 1; depth <= 3; depth++ {
+			game := mustParseFEN(t, tt.fen)
+			move, ok := NewAI(game.CurrentPlayer, depth).BestMove(game)
+			if !ok {
+				t.Fatalf("%s: no move found", tt.name)
+			}
+
+			san := game.SAN(move)
+			if tt.avoid != "" && san == tt.avoid {
+				t.Errorf("%s: depth %d plays the losing %s", tt.name, depth, san)
+			}
+			if tt.play != "" && san != tt.play {
+				t.Errorf("%s: depth %d plays %s instead of %s", tt.name, depth, san, tt.play)
+			}
+		}
+	}
+}
+
+func TestQuiescenceResolvesExchanges(t *testing.T) {
+	// White to move can only lose material by capturing on d5
+	game := mustParseFEN(t, "3rk3/3r4/8/3p4/8/8/3R4/3RK3 w - - 0 1")
+	ai := NewAI(White, 1)
+	static := ai.evaluatePosition(game)
+
+	for _, move := range game.tacticalMoves() {
+		game.makeMove(move)
+		score := -ai.quiescence(game, math.Inf(-1), math.Inf(1), 1)
+		game.unmakeLastMove()
+
+		// Rxd5 Rxd5 Rxd5 Rxd5 gives two rooks for a rook and a pawn
+		if score > static-3 {
+			t.Errorf("After %s quiescence scores %.2f, expected the exchange to lose about 4 from %.2f",
+				game.SAN(move), score, static)
+		}
+	}
+}
+
+func TestTacticalMovesAndMobility(t *testing.T) {
+	for _, position := range PerftPositions {
+		game := mustParseFEN(t, position.FEN)
+
+		var want []Move
+		for _, move := range game.LegalMoves() {
+			if game.Board.GetPiece(move.To) != nil || game.IsEnPassantMove(move) || move.Promotion != NoPromotion {
+				want = append(want, move)
+			}
+		}
+		if got := game.tacticalMoves(); !sameMoves(got, want) {
+			t.Errorf("%s: tacticalMoves = %v, want %v", position.Name, got, want)
+		}
+
+		for _, player := range []Color{White, Black} {
+			if got, want := game.mobility(player), len(game.pseudoLegalMoves(player)); got != want {
+				t.Errorf("%s: mobility(%v) = %d, want %d", position.Name, player, got, want)
+			}
+		}
+	}
+}
+
+// sameMoves reports whether two move lists hold the same moves in any order
+func sameMoves(a, b []Move) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[Move]int)
+	for _, move := range a {
+		counts[move]++
+	}
+	for _, move := range b {
+		counts[move]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// benchmarkSearch searches a position to a fixed depth with a fresh AI each
+// iteration and reports the search speed in nodes per second
+func benchmarkSearch(b *testing.B, fen string, depth int) {
+	game, err := ParseFEN(fen)
+	if err != nil {
+		b.Fatalf("Failed to parse FEN: %v", err)
+	}
+
+	var nodes uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ai := NewAI(game.CurrentPlayer, depth)
+		ai.BestMove(game)
+		nodes += ai.Nodes()
+	}
+	b.ReportMetric(float64(nodes)/b.Elapsed().Seconds(), "nodes/s")
+}
+
+func BenchmarkSearchStartPosition(b *testing.B) {
+	benchmarkSearch(b, StartFEN, 3)
+}
+
+func BenchmarkSearchKiwipete(b *testing.B) {
+	benchmarkSearch(b, PerftPositions[1].FEN, 3)
+}
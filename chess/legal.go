@@ -0,0 +1,148 @@
+package chess
+
+// LegalMoves returns all legal moves for the current player
+func (g *Game) LegalMoves() []Move {
+	var moves []Move
+	for _, move := range g.pseudoLegalMoves(g.CurrentPlayer) {
+		if !g.leavesKingInCheck(move, g.CurrentPlayer) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// LegalMovesFrom returns the legal moves of the current player's piece at the given position
+func (g *Game) LegalMovesFrom(pos Position) []Move {
+	var moves []Move
+	for _, move := range g.LegalMoves() {
+		if move.From == pos {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// IsLegal checks if the move can be played by the current player
+func (g *Game) IsLegal(move Move) bool {
+	return g.validateMove(move) == nil
+}
+
+// validateMove returns the reason a move cannot be played, or nil if it is legal
+func (g *Game) validateMove(move Move) error {
+	if !g.IsEnPassantMove(move) && !g.Board.IsValidMove(move, g.CurrentPlayer) {
+		return ErrInvalidMove
+	}
+
+	if err := g.validatePromotion(move); err != nil {
+		return err
+	}
+
+	if g.leavesKingInCheck(move, g.CurrentPlayer) {
+		return ErrLeavesKingInCheck
+	}
+
+	return nil
+}
+
+// pseudoLegalMoves returns the moves the player's pieces can make without
+// considering king safety. Promotions are expanded into one move per piece.
+func (g *Game) pseudoLegalMoves(player Color) []Move {
+	var moves []Move
+	for pieces := g.Board.colors[player]; pieces != 0; {
+		from := squarePosition(pieces.popFirst())
+		for _, move := range g.Board.GetValidMoves(from) {
+			if !g.Board.IsPromotionMove(move) {
+				moves = append(moves, move)
+				continue
+			}
+			for _, promotion := range PromotionPieces {
+				moves = append(moves, NewPromotionMove(move.From, move.To, promotion))
+			}
+		}
+	}
+	return append(moves, g.enPassantMoves(player)...)
+}
+
+// tacticalMoves returns the legal captures and promotions of the current player
+func (g *Game) tacticalMoves() []Move {
+	player := g.CurrentPlayer
+	enemy := g.Board.colors[player.Opponent()]
+	lastRank := bitboard(0xFF)
+	if player == Black {
+		lastRank <<= 56
+	}
+
+	var moves []Move
+	for pieces := g.Board.colors[player]; pieces != 0; {
+		sq := pieces.popFirst()
+		from := squarePosition(sq)
+		piece := g.Board.GetPiece(from)
+
+		targets := g.Board.moveTargets(sq, piece) & enemy
+		if piece.Type == Pawn {
+			targets = g.Board.moveTargets(sq, piece) & (enemy | lastRank)
+		}
+		for targets != 0 {
+			move := NewMove(from, squarePosition(targets.popFirst()))
+			if g.leavesKingInCheck(move, player) {
+				continue
+			}
+			if piece.Type != Pawn || !g.Board.IsPromotionMove(move) {
+				moves = append(moves, move)
+				continue
+			}
+			for _, promotion := range PromotionPieces {
+				moves = append(moves, NewPromotionMove(move.From, move.To, promotion))
+			}
+		}
+	}
+
+	for _, move := range g.enPassantMoves(player) {
+		if !g.leavesKingInCheck(move, player) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// mobility returns the number of pseudo-legal moves of the player, the
+// length of pseudoLegalMoves, without building the list
+func (g *Game) mobility(player Color) int {
+	lastRanks := bitboard(0xFF) | bitboard(0xFF)<<56
+
+	count := 0
+	for pieces := g.Board.colors[player]; pieces != 0; {
+		sq := pieces.popFirst()
+		piece := g.Board.GetPiece(squarePosition(sq))
+		targets := g.Board.moveTargets(sq, piece)
+		count += targets.count()
+		if piece.Type == Pawn {
+			// Each promotion counts once per promotion piece
+			count += (targets & lastRanks).count() * (len(PromotionPieces) - 1)
+		}
+	}
+	return count + len(g.enPassantMoves(player))
+}
+
+// leavesKingInCheck tries the move on the board and reports whether the
+// player's king would be attacked afterwards. The board is restored before returning.
+func (g *Game) leavesKingInCheck(move Move, player Color) bool {
+	piece := g.Board.GetPiece(move.From)
+	capturePos := move.To
+	if g.IsEnPassantMove(move) {
+		capturePos = EnPassantCapturePosition(move)
+	}
+	captured := g.Board.GetPiece(capturePos)
+
+	g.Board.SetPiece(capturePos, nil)
+	g.Board.SetPiece(move.To, piece)
+	g.Board.SetPiece(move.From, nil)
+
+	inCheck := g.isInCheck(player)
+
+	g.Board.SetPiece(move.From, piece)
+	g.Board.SetPiece(move.To, nil)
+	g.Board.SetPiece(capturePos, captured)
+
+	return inCheck
+}
@@ -1,20 +1,122 @@
 package chess
 
-import "math"
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// NoPromotion marks a move without a promotion choice. A pawn can never
+// promote to a king, so the zero PieceType doubles as the sentinel.
+const NoPromotion = King
+
+// PromotionPieces lists the piece types a pawn may promote to
+var PromotionPieces = []PieceType{Queen, Rook, Bishop, Knight}
 
 // Move represents a chess move
 type Move struct {
-	From Position
-	To   Position
+	From      Position
+	To        Position
+	Promotion PieceType
 }
 
+// Movement offsets used to build the attack tables
+var (
+	knightOffsets = [8][2]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+	kingOffsets   = [8][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+)
+
 // NewMove creates a new move
 func NewMove(from, to Position) Move {
 	return Move{From: from, To: to}
 }
 
+// NewPromotionMove creates a new pawn move that promotes to the given piece
+func NewPromotionMove(from, to Position, promotion PieceType) Move {
+	return Move{From: from, To: to, Promotion: promotion}
+}
+
+// String returns the move in coordinate notation (e.g., "e2e4" or "e7e8q")
+func (m Move) String() string {
+	if m.Promotion == NoPromotion {
+		return m.From.String() + m.To.String()
+	}
+	return m.From.String() + m.To.String() + promotionLetter(m.Promotion)
+}
+
+// ParseMove parses a move in coordinate notation, the format returned by
+// Move.String (e.g., "e2e4" or "e7e8q")
+func ParseMove(s string) (Move, error) {
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("invalid move: %s", s)
+	}
+
+	from, err := FromAlgebraic(s[0:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %s: %v", s, err)
+	}
+	to, err := FromAlgebraic(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %s: %v", s, err)
+	}
+
+	promotion := NoPromotion
+	if len(s) == 5 {
+		if promotion, err = ParsePromotion(s[4:]); err != nil {
+			return Move{}, fmt.Errorf("invalid move %s: %v", s, err)
+		}
+	}
+
+	return NewPromotionMove(from, to, promotion), nil
+}
+
+// ParsePromotion converts a piece letter (q, r, b or n) to a promotion piece type
+func ParsePromotion(letter string) (PieceType, error) {
+	switch strings.ToLower(letter) {
+	case "q":
+		return Queen, nil
+	case "r":
+		return Rook, nil
+	case "b":
+		return Bishop, nil
+	case "n":
+		return Knight, nil
+	default:
+		return NoPromotion, fmt.Errorf("invalid promotion piece: %s", letter)
+	}
+}
+
+// promotionLetter returns the lowercase letter for a promotion piece type
+func promotionLetter(pieceType PieceType) string {
+	switch pieceType {
+	case Queen:
+		return "q"
+	case Rook:
+		return "r"
+	case Bishop:
+		return "b"
+	case Knight:
+		return "n"
+	default:
+		return ""
+	}
+}
+
+// IsPromotionMove reports whether the move takes a pawn to its last rank
+func (b *Board) IsPromotionMove(move Move) bool {
+	piece := b.GetPiece(move.From)
+	if piece == nil || piece.Type != Pawn {
+		return false
+	}
+	return (piece.Color == White && move.To.Row == 0) || (piece.Color == Black && move.To.Row == 7)
+}
+
 // IsValidMove checks if a move is valid for the given board state
 func (b *Board) IsValidMove(move Move, currentPlayer Color) bool {
+	if !move.From.IsValid() || !move.To.IsValid() {
+		return false
+	}
+
 	piece := b.GetPiece(move.From)
 	if piece == nil {
 		return false
@@ -25,108 +127,143 @@ func (b *Board) IsValidMove(move Move, currentPlayer Color) bool {
 		return false
 	}
 
-	// Check if destination has own piece
-	destPiece := b.GetPiece(move.To)
-	if destPiece != nil && destPiece.Color == piece.Color {
-		return false
-	}
+	return b.moveTargets(squareIndex(move.From), piece).has(squareIndex(move.To))
+}
+
+// moveTargets returns the squares the piece on sq can move to, ignoring king
+// safety and en passant. Castling squares are included when castling is allowed.
+func (b *Board) moveTargets(sq int, piece *Piece) bitboard {
+	own := b.colors[piece.Color]
+	occupied := b.occupied()
 
-	// Check piece-specific movement rules
 	switch piece.Type {
 	case Pawn:
-		return b.isValidPawnMove(move, piece)
-	case Rook:
-		return b.isValidRookMove(move)
+		return b.pawnTargets(sq, piece.Color)
 	case Knight:
-		return b.isValidKnightMove(move)
+		return knightAttacks[sq] &^ own
 	case Bishop:
-		return b.isValidBishopMove(move)
+		return bishopAttacks(sq, occupied) &^ own
+	case Rook:
+		return rookAttacks(sq, occupied) &^ own
 	case Queen:
-		return b.isValidQueenMove(move)
+		return (rookAttacks(sq, occupied) | bishopAttacks(sq, occupied)) &^ own
 	case King:
-		return b.isValidKingMove(move)
+		targets := kingAttacks[sq] &^ own
+		from := squarePosition(sq)
+		for _, col := range []int{from.Col - 2, from.Col + 2} {
+			if to := NewPosition(from.Row, col); to.IsValid() && b.isValidCastlingMove(NewMove(from, to), piece) {
+				targets |= squareBit(squareIndex(to))
+			}
+		}
+		return targets
 	}
 
-	return false
+	return 0
 }
 
-// isValidPawnMove validates pawn movement
-func (b *Board) isValidPawnMove(move Move, piece *Piece) bool {
-	rowDiff := move.To.Row - move.From.Row
-	colDiff := move.To.Col - move.From.Col
+// pawnTargets returns the pushes and captures of a pawn on sq
+func (b *Board) pawnTargets(sq int, color Color) bitboard {
+	occupied := b.occupied()
 
-	direction := -1 // White moves up (decreasing row numbers)
+	direction := -8 // White moves up (decreasing row numbers)
 	startRow := 6   // White pawns start at row 6
-	if piece.Color == Black {
-		direction = 1 // Black moves down (increasing row numbers)
+	if color == Black {
+		direction = 8 // Black moves down (increasing row numbers)
 		startRow = 1  // Black pawns start at row 1
 	}
 
-	// Forward move
-	if colDiff == 0 {
-		// One square forward
-		if rowDiff == direction {
-			return b.GetPiece(move.To) == nil
-		}
-		// Two squares forward from starting position
-		if rowDiff == 2*direction && move.From.Row == startRow {
-			return b.GetPiece(move.To) == nil && b.GetPiece(NewPosition(move.From.Row+direction, move.From.Col)) == nil
+	targets := pawnAttacks[color][sq] & b.colors[color.Opponent()]
+
+	// One square forward, and two from the starting row, onto empty squares
+	if one := sq + direction; one >= 0 && one < 64 && !occupied.has(one) {
+		targets |= squareBit(one)
+		if two := one + direction; sq/8 == startRow && !occupied.has(two) {
+			targets |= squareBit(two)
 		}
 	}
 
-	// Diagonal capture
-	if math.Abs(float64(colDiff)) == 1 && rowDiff == direction {
-		destPiece := b.GetPiece(move.To)
-		return destPiece != nil && destPiece.Color != piece.Color
+	return targets
+}
+
+// isValidCastlingMove validates king-side and queen-side castling
+func (b *Board) isValidCastlingMove(move Move, king *Piece) bool {
+	homeRow := 7
+	if king.Color == Black {
+		homeRow = 0
 	}
 
-	return false
-}
+	if king.HasMoved || move.From != NewPosition(homeRow, 4) || move.To.Row != homeRow {
+		return false
+	}
 
-// isValidRookMove validates rook movement
-func (b *Board) isValidRookMove(move Move) bool {
-	// Rook moves horizontally or vertically
-	if move.From.Row != move.To.Row && move.From.Col != move.To.Col {
+	rookPos := CastlingRookPosition(move)
+	rook := b.GetPiece(rookPos)
+	if rook == nil || rook.Type != Rook || rook.Color != king.Color || rook.HasMoved {
 		return false
 	}
 
-	return b.isPathClear(move.From, move.To)
-}
+	// All squares between the king and the rook must be empty
+	if !b.isPathClear(move.From, rookPos) {
+		return false
+	}
 
-// isValidKnightMove validates knight movement
-func (b *Board) isValidKnightMove(move Move) bool {
-	rowDiff := int(math.Abs(float64(move.To.Row - move.From.Row)))
-	colDiff := int(math.Abs(float64(move.To.Col - move.From.Col)))
+	// The king may not castle out of, through, or into check
+	step := 1
+	if move.To.Col < move.From.Col {
+		step = -1
+	}
+	opponent := king.Color.Opponent()
+	for col := move.From.Col; col != move.To.Col+step; col += step {
+		if b.IsSquareAttacked(NewPosition(homeRow, col), opponent) {
+			return false
+		}
+	}
 
-	return (rowDiff == 2 && colDiff == 1) || (rowDiff == 1 && colDiff == 2)
+	return true
 }
 
-// isValidBishopMove validates bishop movement
-func (b *Board) isValidBishopMove(move Move) bool {
-	rowDiff := int(math.Abs(float64(move.To.Row - move.From.Row)))
-	colDiff := int(math.Abs(float64(move.To.Col - move.From.Col)))
+// IsCastlingMove reports whether the move is a king moving two squares sideways
+func (b *Board) IsCastlingMove(move Move) bool {
+	piece := b.GetPiece(move.From)
+	return piece != nil && piece.Type == King &&
+		move.From.Row == move.To.Row && int(math.Abs(float64(move.To.Col-move.From.Col))) == 2
+}
 
-	// Bishop moves diagonally
-	if rowDiff != colDiff {
-		return false
+// CastlingRookPosition returns the starting square of the rook involved in a castling move
+func CastlingRookPosition(move Move) Position {
+	if move.To.Col > move.From.Col {
+		return NewPosition(move.From.Row, 7)
 	}
-
-	return b.isPathClear(move.From, move.To)
+	return NewPosition(move.From.Row, 0)
 }
 
-// isValidQueenMove validates queen movement
-func (b *Board) isValidQueenMove(move Move) bool {
-	// Queen moves like rook or bishop
-	return b.isValidRookMove(move) || b.isValidBishopMove(move)
+// CastlingRookTarget returns the square the rook lands on after a castling move
+func CastlingRookTarget(move Move) Position {
+	if move.To.Col > move.From.Col {
+		return NewPosition(move.From.Row, 5)
+	}
+	return NewPosition(move.From.Row, 3)
 }
 
-// isValidKingMove validates king movement
-func (b *Board) isValidKingMove(move Move) bool {
-	rowDiff := int(math.Abs(float64(move.To.Row - move.From.Row)))
-	colDiff := int(math.Abs(float64(move.To.Col - move.From.Col)))
+// IsSquareAttacked checks if any piece of the given color attacks the square
+func (b *Board) IsSquareAttacked(pos Position, by Color) bool {
+	if !pos.IsValid() {
+		return false
+	}
+	sq := squareIndex(pos)
+	attackers := &b.pieces[by]
+
+	// A pawn attacks the square if a pawn of the other color on it would attack the pawn
+	if pawnAttacks[by.Opponent()][sq]&attackers[Pawn] != 0 ||
+		knightAttacks[sq]&attackers[Knight] != 0 ||
+		kingAttacks[sq]&attackers[King] != 0 {
+		return true
+	}
 
-	// King moves one square in any direction
-	return rowDiff <= 1 && colDiff <= 1
+	// Sliding pieces attack along rays until the first blocker
+	occupied := b.occupied()
+	return rookAttacks(sq, occupied)&(attackers[Rook]|attackers[Queen]) != 0 ||
+		bishopAttacks(sq, occupied)&(attackers[Bishop]|attackers[Queen]) != 0
 }
 
 // isPathClear checks if the path between two positions is clear
@@ -168,14 +305,9 @@ func (b *Board) GetValidMoves(pos Position) []Move {
 		return moves
 	}
 
-	for row := 0; row < 8; row++ {
-		for col := 0; col < 8; col++ {
-			to := NewPosition(row, col)
-			move := NewMove(pos, to)
-			if b.IsValidMove(move, piece.Color) {
-				moves = append(moves, move)
-			}
-		}
+	targets := b.moveTargets(squareIndex(pos), piece)
+	for targets != 0 {
+		moves = append(moves, NewMove(pos, squarePosition(targets.popFirst())))
 	}
 
 	return moves
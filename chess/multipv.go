@@ -0,0 +1,79 @@
+package chess
+
+import "sort"
+
+// Line is one of the lines of play a search ranks, given by its score and
+// its principal variation
+type Line struct {
+	Score float64 // in pawns, from the point of view of the AI's color
+	PV    []Move
+}
+
+// MateIn returns the number of moves to a forced mate in the line, negative
+// when the AI is the side getting mated
+func (l Line) MateIn() (int, bool) {
+	return mateIn(l.Score)
+}
+
+// SetMultiPV sets how many lines a search ranks, at least one. With more, each
+// iteration searches the root again for the best move not yet ranked, until
+// it has that many lines or has ranked every legal move. The lines are in
+// the Lines of the result, best first.
+func (ai *AI) SetMultiPV(lines int) {
+	ai.multiPV = max(lines, 1)
+}
+
+// MultiPV returns how many lines a search ranks
+func (ai *AI) MultiPV() int {
+	return max(ai.multiPV, 1)
+}
+
+// searchLines searches the root to the given depth for the best lines, one
+// by one, each guessing its score from the line of the same rank in the
+// previous iteration. If the search is stopped, it returns the lines it
+// completed.
+func (ai *AI) searchLines(game *Game, depth int, previous []Line) []Line {
+	count := min(ai.MultiPV(), len(game.LegalMoves()))
+	lines := make([]Line, 0, count)
+
+	defer func() { ai.excluded = nil }()
+	for len(lines) < count {
+		guess := 0.0
+		if len(lines) < len(previous) {
+			guess = previous[len(lines)].Score
+		}
+
+		score := ai.aspirationSearch(game, depth, guess)
+		if ai.stopped {
+			break
+		}
+		pv := ai.principalVariation()
+		lines = append(lines, Line{Score: score, PV: pv})
+		ai.excluded = append(ai.excluded, pv[0])
+	}
+
+	// Later lines can outscore earlier ones when they see more of the tree
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Score > lines[j].Score
+	})
+	return lines
+}
+
+// withoutExcluded removes the root moves that already start a line
+func (ai *AI) withoutExcluded(moves []Move) []Move {
+	if len(ai.excluded) == 0 {
+		return moves
+	}
+
+	kept := moves[:0]
+	for _, move := range moves {
+		excluded := false
+		for _, line := range ai.excluded {
+			excluded = excluded || move == line
+		}
+		if !excluded {
+			kept = append(kept, move)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,81 @@
+package chess
+
+// PerftPosition is a reference position with known perft node counts
+type PerftPosition struct {
+	Name  string
+	FEN   string
+	Nodes []uint64 // Nodes[i] is the node count at depth i+1
+}
+
+// PerftPositions are the standard perft test positions from the Chess
+// Programming Wiki, chosen to exercise castling, en passant, promotions and
+// discovered checks
+var PerftPositions = []PerftPosition{
+	{
+		Name:  "Start position",
+		FEN:   StartFEN,
+		Nodes: []uint64{20, 400, 8902, 197281, 4865609, 119060324},
+	},
+	{
+		Name:  "Kiwipete",
+		FEN:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		Nodes: []uint64{48, 2039, 97862, 4085603, 193690690},
+	},
+	{
+		Name:  "Position 3",
+		FEN:   "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		Nodes: []uint64{14, 191, 2812, 43238, 674624, 11030083},
+	},
+	{
+		Name:  "Position 4",
+		FEN:   "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		Nodes: []uint64{6, 264, 9467, 422333, 15833292},
+	},
+	{
+		Name:  "Position 5",
+		FEN:   "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		Nodes: []uint64{44, 1486, 62379, 2103487, 89941194},
+	},
+	{
+		Name:  "Position 6",
+		FEN:   "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		Nodes: []uint64{46, 2079, 89890, 3894594, 164075551},
+	},
+}
+
+// Perft counts the leaf nodes of the legal move tree to the given depth.
+// Comparing the counts with known values verifies the move generator.
+func (g *Game) Perft(depth int) uint64 {
+	if depth <= 0 {
+		return 1
+	}
+
+	moves := g.LegalMoves()
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+
+	var nodes uint64
+	for _, move := range moves {
+		record := g.playMove(move)
+		nodes += g.Perft(depth - 1)
+		g.takeBack(record)
+	}
+	return nodes
+}
+
+// Divide returns the perft node count below each legal move, which narrows a
+// perft mismatch down to the move whose subtree is wrong
+func (g *Game) Divide(depth int) map[Move]uint64 {
+	counts := make(map[Move]uint64)
+	if depth <= 0 {
+		return counts
+	}
+
+	for _, move := range g.LegalMoves() {
+		record := g.playMove(move)
+		counts[move] = g.Perft(depth - 1)
+		g.takeBack(record)
+	}
+	return counts
+}
@@ -0,0 +1,138 @@
+package chess
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pgnLineWidth is the maximum length of a movetext line in exported PGN
+const pgnLineWidth = 80
+
+// sevenTagRoster lists the mandatory PGN tags in their required order
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// sevenTagDefaults holds the values used for roster tags that are not set
+var sevenTagDefaults = map[string]string{
+	"Event": "?",
+	"Site":  "?",
+	"Date":  "????.??.??",
+	"Round": "?",
+	"White": "?",
+	"Black": "?",
+}
+
+// PGN returns the game in Portable Game Notation, with the Seven Tag Roster
+// followed by any other tags from Tags and the movetext in SAN
+func (g *Game) PGN() string {
+	var sb strings.Builder
+	result := g.resultToken()
+
+	tags := map[string]string{}
+	for name, value := range sevenTagDefaults {
+		tags[name] = value
+	}
+	for name, value := range g.Tags {
+		tags[name] = value
+	}
+	tags["Result"] = result
+	if g.startFEN != "" {
+		tags["SetUp"] = "1"
+		tags["FEN"] = g.startFEN
+	}
+
+	for _, name := range sevenTagRoster {
+		writePGNTag(&sb, name, tags[name])
+		delete(tags, name)
+	}
+
+	others := make([]string, 0, len(tags))
+	for name := range tags {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		writePGNTag(&sb, name, tags[name])
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(wrapPGNTokens(append(g.movetextTokens(), result)))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// writePGNTag writes a tag pair, escaping backslashes and quotes in the value
+func writePGNTag(sb *strings.Builder, name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	fmt.Fprintf(sb, "[%s \"%s\"]\n", name, value)
+}
+
+// movetextTokens replays the move history from the starting position and
+// returns move numbers and SAN moves as separate tokens
+func (g *Game) movetextTokens() []string {
+	replay := g.initialPosition()
+	tokens := make([]string, 0, len(g.MoveHistory)*3/2)
+
+	for i, move := range g.MoveHistory {
+		if replay.CurrentPlayer == White {
+			tokens = append(tokens, fmt.Sprintf("%d.", replay.FullmoveNumber))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", replay.FullmoveNumber))
+		}
+
+		san := replay.sanBase(move)
+		if err := replay.ApplyMove(move); err != nil {
+			// History that cannot be replayed is written as-is rather than dropped
+			tokens = append(tokens, move.String())
+			continue
+		}
+		tokens = append(tokens, san+sanSuffix(replay))
+	}
+
+	return tokens
+}
+
+// initialPosition returns a new game set up at the position this game started from
+func (g *Game) initialPosition() *Game {
+	if g.startFEN != "" {
+		if game, err := ParseFEN(g.startFEN); err == nil {
+			return game
+		}
+	}
+	return NewGame()
+}
+
+// resultToken returns the PGN result of the game: "1-0", "0-1", "1/2-1/2" or "*"
+func (g *Game) resultToken() string {
+	if result := g.Result(); result != NoResult {
+		return result.String()
+	}
+
+	// An unfinished position may still carry a result decided off the board
+	switch result := g.Tags["Result"]; result {
+	case "1-0", "0-1", "1/2-1/2":
+		return result
+	}
+	return "*"
+}
+
+// wrapPGNTokens joins tokens with spaces, breaking lines before they exceed pgnLineWidth
+func wrapPGNTokens(tokens []string) string {
+	var sb strings.Builder
+	lineLength := 0
+	for _, token := range tokens {
+		if lineLength > 0 && lineLength+1+len(token) > pgnLineWidth {
+			sb.WriteString("\n")
+			lineLength = 0
+		}
+		if lineLength > 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+		sb.WriteString(token)
+		lineLength += len(token)
+	}
+	return sb.String()
+}
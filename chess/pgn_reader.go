@@ -0,0 +1,387 @@
+package chess
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// PGNError describes a problem with one game of a PGN database
+type PGNError struct {
+	Game int   // 1-based index of the game in the input
+	Ply  int   // 1-based ply of the offending move, or 0 outside the movetext
+	Err  error // underlying error
+}
+
+// Error returns the error message including the game index and ply
+func (e *PGNError) Error() string {
+	if e.Ply > 0 {
+		return fmt.Sprintf("pgn game %d, ply %d: %v", e.Game, e.Ply, e.Err)
+	}
+	return fmt.Sprintf("pgn game %d: %v", e.Game, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PGNError) Unwrap() error {
+	return e.Err
+}
+
+// pgnTokenKind identifies the kind of a PGN token
+type pgnTokenKind int
+
+const (
+	pgnEOF pgnTokenKind = iota
+	pgnTag
+	pgnSymbol
+	pgnComment
+	pgnNAG
+	pgnOpenVariation
+	pgnCloseVariation
+	pgnResult
+	pgnInvalid
+)
+
+// pgnToken is a single lexical element of a PGN file
+type pgnToken struct {
+	kind  pgnTokenKind
+	name  string // tag name
+	value string // tag value, symbol, comment text, result or syntax error message
+}
+
+// invalidToken returns a token reporting a syntax error in the input
+func invalidToken(format string, args ...any) pgnToken {
+	return pgnToken{kind: pgnInvalid, value: fmt.Sprintf(format, args...)}
+}
+
+// PGNReader reads games one at a time from a PGN database
+type PGNReader struct {
+	r           *bufio.Reader
+	games       int
+	pending     *pgnToken
+	atLineStart bool
+}
+
+// NewPGNReader creates a reader that parses PGN games from r
+func NewPGNReader(r io.Reader) *PGNReader {
+	return &PGNReader{r: bufio.NewReader(r), atLineStart: true}
+}
+
+// ParsePGN parses a single game from a PGN string
+func ParsePGN(pgn string) (*Game, error) {
+	return NewPGNReader(strings.NewReader(pgn)).Next()
+}
+
+// Next reads the next game, replaying every move of the main line through
+// ApplyMove. Comments, NAGs and variations are parsed and skipped. It returns
+// io.EOF when there are no more games. A malformed game yields a *PGNError and
+// the reader moves on to the following game.
+func (pr *PGNReader) Next() (*Game, error) {
+	tags := map[string]string{}
+	var game *Game
+	var gameErr error
+	started := false
+	depth := 0
+	ply := 0
+	index := pr.games + 1
+
+	for {
+		token, err := pr.nextToken()
+		if err != nil {
+			pr.games++
+			return nil, &PGNError{Game: index, Ply: ply, Err: err}
+		}
+
+		if token.kind == pgnEOF && !started {
+			return nil, io.EOF
+		}
+		started = true
+
+		switch token.kind {
+		case pgnInvalid:
+			if gameErr == nil {
+				gameErr = &PGNError{Game: index, Ply: ply, Err: errors.New(token.value)}
+			}
+
+		case pgnTag:
+			if game != nil || gameErr != nil {
+				// A tag after the movetext starts the next game
+				pr.pending = &token
+				return pr.finishGame(game, tags, gameErr, index, depth, ply)
+			}
+			tags[token.name] = token.value
+
+		case pgnSymbol:
+			if depth > 0 || gameErr != nil {
+				continue
+			}
+			if game == nil {
+				if game, err = gameFromTags(tags); err != nil {
+					gameErr = &PGNError{Game: index, Err: err}
+					continue
+				}
+			}
+			ply++
+			move, err := game.ParseSAN(token.value)
+			if err == nil {
+				err = game.ApplyMove(move)
+			}
+			if err != nil {
+				gameErr = &PGNError{Game: index, Ply: ply, Err: err}
+			}
+
+		case pgnOpenVariation:
+			depth++
+
+		case pgnCloseVariation:
+			if depth == 0 && gameErr == nil {
+				gameErr = &PGNError{Game: index, Ply: ply, Err: errors.New("unexpected ')' outside a variation")}
+			}
+			if depth > 0 {
+				depth--
+			}
+
+		case pgnResult:
+			if depth > 0 {
+				continue
+			}
+			tags["Result"] = token.value
+			return pr.finishGame(game, tags, gameErr, index, depth, ply)
+
+		case pgnEOF:
+			return pr.finishGame(game, tags, gameErr, index, depth, ply)
+		}
+	}
+}
+
+// finishGame completes the game being read and returns it or the first error found in it
+func (pr *PGNReader) finishGame(game *Game, tags map[string]string, gameErr error, index, depth, ply int) (*Game, error) {
+	pr.games++
+
+	if gameErr != nil {
+		return nil, gameErr
+	}
+	if depth > 0 {
+		return nil, &PGNError{Game: index, Ply: ply, Err: errors.New("unterminated variation")}
+	}
+
+	if game == nil {
+		var err error
+		if game, err = gameFromTags(tags); err != nil {
+			return nil, &PGNError{Game: index, Err: err}
+		}
+	}
+	game.Tags = tags
+
+	return game, nil
+}
+
+// gameFromTags creates the starting position of a game, honouring a FEN tag
+func gameFromTags(tags map[string]string) (*Game, error) {
+	fen, ok := tags["FEN"]
+	if !ok {
+		return NewGame(), nil
+	}
+
+	game, err := ParseFEN(fen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEN tag: %v", err)
+	}
+	return game, nil
+}
+
+// nextToken returns the next token, or a pgnEOF token at the end of the input.
+// Syntax errors are reported as pgnInvalid tokens; the error result is for I/O failures.
+func (pr *PGNReader) nextToken() (pgnToken, error) {
+	if pr.pending != nil {
+		token := *pr.pending
+		pr.pending = nil
+		return token, nil
+	}
+
+	for {
+		lineStart := pr.atLineStart
+		ch, err := pr.readRune()
+		if err == io.EOF {
+			return pgnToken{kind: pgnEOF}, nil
+		}
+		if err != nil {
+			return pgnToken{}, err
+		}
+
+		switch {
+		case unicode.IsSpace(ch):
+			continue
+		case ch == '%' && lineStart:
+			// Escape lines are reserved for other tools and ignored
+			if _, err := pr.readUntil('\n'); err != nil && err != io.EOF {
+				return pgnToken{}, err
+			}
+		case ch == '[':
+			return pr.readTag()
+		case ch == '{':
+			text, err := pr.readUntil('}')
+			if err == io.EOF {
+				return invalidToken("unterminated comment"), nil
+			}
+			return pgnToken{kind: pgnComment, value: text}, err
+		case ch == ';':
+			text, err := pr.readUntil('\n')
+			if err != nil && err != io.EOF {
+				return pgnToken{}, err
+			}
+			return pgnToken{kind: pgnComment, value: text}, nil
+		case ch == '(':
+			return pgnToken{kind: pgnOpenVariation}, nil
+		case ch == ')':
+			return pgnToken{kind: pgnCloseVariation}, nil
+		case ch == '*':
+			return pgnToken{kind: pgnResult, value: "*"}, nil
+		case ch == '$':
+			digits, err := pr.readSymbol()
+			if err != nil {
+				return pgnToken{}, err
+			}
+			if digits == "" || strings.Trim(digits, "0123456789") != "" {
+				return invalidToken("invalid NAG: $%s", digits), nil
+			}
+			return pgnToken{kind: pgnNAG, value: digits}, nil
+		default:
+			if err := pr.r.UnreadRune(); err != nil {
+				return pgnToken{}, err
+			}
+			symbol, err := pr.readSymbol()
+			if err != nil {
+				return pgnToken{}, err
+			}
+			if symbol == "" {
+				// A stray delimiter such as ']' or '"' cannot start a token
+				if _, err := pr.readRune(); err != nil {
+					return pgnToken{}, err
+				}
+				return invalidToken("unexpected character %q", ch), nil
+			}
+			if token, ok := classifySymbol(symbol); ok {
+				return token, nil
+			}
+		}
+	}
+}
+
+// classifySymbol turns a movetext symbol into a result or move token. Move
+// numbers are dropped, including when they are glued to the move ("12.e4").
+func classifySymbol(symbol string) (pgnToken, bool) {
+	switch symbol {
+	case "1-0", "0-1", "1/2-1/2":
+		return pgnToken{kind: pgnResult, value: symbol}, true
+	}
+
+	if !strings.HasPrefix(symbol, "0-0") {
+		symbol = strings.TrimLeft(symbol, "0123456789")
+		symbol = strings.TrimLeft(symbol, ".")
+	}
+	if symbol == "" {
+		return pgnToken{}, false
+	}
+	return pgnToken{kind: pgnSymbol, value: symbol}, true
+}
+
+// readTag reads a tag pair after its opening bracket
+func (pr *PGNReader) readTag() (pgnToken, error) {
+	body, err := pr.readUntilUnquoted(']')
+	if err == io.EOF {
+		return invalidToken("unterminated tag pair"), nil
+	}
+	if err != nil {
+		return pgnToken{}, err
+	}
+
+	body = strings.TrimSpace(body)
+	nameEnd := strings.IndexFunc(body, unicode.IsSpace)
+	if nameEnd <= 0 {
+		return invalidToken("invalid tag pair: [%s]", body), nil
+	}
+	name := body[:nameEnd]
+	quoted := strings.TrimSpace(body[nameEnd:])
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		return invalidToken("invalid value for tag %s: %s", name, quoted), nil
+	}
+
+	value := quoted[1 : len(quoted)-1]
+	value = strings.ReplaceAll(value, `\"`, `"`)
+	value = strings.ReplaceAll(value, `\\`, `\`)
+
+	return pgnToken{kind: pgnTag, name: name, value: value}, nil
+}
+
+// readSymbol reads characters up to the next whitespace or delimiter
+func (pr *PGNReader) readSymbol() (string, error) {
+	var sb strings.Builder
+	for {
+		ch, err := pr.readRune()
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if unicode.IsSpace(ch) || strings.ContainsRune("[]{}();$*\"", ch) {
+			if err := pr.r.UnreadRune(); err != nil {
+				return "", err
+			}
+			pr.atLineStart = false
+			return sb.String(), nil
+		}
+		sb.WriteRune(ch)
+	}
+}
+
+// readUntil reads up to and including the delimiter and returns the text before it
+func (pr *PGNReader) readUntil(delim rune) (string, error) {
+	var sb strings.Builder
+	for {
+		ch, err := pr.readRune()
+		if err != nil {
+			return sb.String(), err
+		}
+		if ch == delim {
+			return sb.String(), nil
+		}
+		sb.WriteRune(ch)
+	}
+}
+
+// readUntilUnquoted is like readUntil but ignores delimiters inside a quoted string
+func (pr *PGNReader) readUntilUnquoted(delim rune) (string, error) {
+	var sb strings.Builder
+	inQuotes, escaped := false, false
+	for {
+		ch, err := pr.readRune()
+		if err != nil {
+			return sb.String(), err
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes && ch == '\\':
+			escaped = true
+		case ch == '"':
+			inQuotes = !inQuotes
+		case ch == delim && !inQuotes:
+			return sb.String(), nil
+		}
+		sb.WriteRune(ch)
+	}
+}
+
+// readRune reads a rune and tracks whether the next one starts a line
+func (pr *PGNReader) readRune() (rune, error) {
+	ch, _, err := pr.r.ReadRune()
+	if err != nil {
+		return ch, err
+	}
+	pr.atLineStart = ch == '\n'
+	return ch, nil
+}
@@ -31,6 +31,14 @@ func (c Color) String() string {
 	}
 }
 
+// Opponent returns the color of the other player
+func (c Color) Opponent() Color {
+	if c == White {
+		return Black
+	}
+	return White
+}
+
 // PieceType represents the type of chess piece
 type PieceType int
 
@@ -68,6 +76,26 @@ func (pt PieceType) String() string {
 	}
 }
 
+// Letter returns the uppercase letter used for the piece type in FEN and algebraic notation
+func (pt PieceType) Letter() string {
+	switch pt {
+	case King:
+		return "K"
+	case Queen:
+		return "Q"
+	case Rook:
+		return "R"
+	case Bishop:
+		return "B"
+	case Knight:
+		return "N"
+	case Pawn:
+		return "P"
+	default:
+		return "?"
+	}
+}
+
 // Piece represents a chess piece
 type Piece struct {
 	Type     PieceType
@@ -125,3 +153,8 @@ func (p *Piece) String() string {
 		return EmptySquare
 	}
 }
+
+// isKnown reports whether the piece is non-nil with a standard type and color
+func (p *Piece) isKnown() bool {
+	return p != nil && p.Type >= King && p.Type <= Pawn && (p.Color == White || p.Color == Black)
+}
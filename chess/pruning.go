@@ -0,0 +1,74 @@
+package chess
+
+// Tuning of the selective search, with margins in pawns
+const (
+	nullMoveMinDepth  = 3   // shallowest depth that tries a null move
+	futilityDepth     = 3   // deepest depth where futility pruning applies
+	futilityMargin    = 1.0 // most a quiet move is expected to gain, per ply of depth
+	lateMoveMinDepth  = 3   // shallowest depth that reduces late moves
+	lateMoveIndex     = 3   // moves searched at full depth before reducing
+	lateMoveDeepIndex = 8   // moves after which a deep search reduces by two plies
+	lateMoveDeepDepth = 6   // depth from which late moves are reduced by two plies
+)
+
+// SearchOptions turns the selective parts of the search on or off. Each one
+// lets the search reach deeper at a small risk of missing a move, and can be
+// switched off on its own to measure what it is worth. NewAI enables them all.
+type SearchOptions struct {
+	// NullMove skips a position when letting the opponent move twice
+	// still leaves the side to move above beta. It is not tried when the
+	// side to move has only pawns, where passing could be its best option.
+	NullMove bool
+	// LateMoveReductions searches quiet moves late in the move order to a
+	// reduced depth first, and fully only if they turn out to raise alpha
+	LateMoveReductions bool
+	// Futility skips quiet moves near the leaves when the evaluation is so far
+	// below alpha that they cannot make up the difference
+	Futility bool
+	// ReverseFutility cuts off positions near the leaves whose evaluation is
+	// so far above beta that the opponent cannot be expected to recover
+	ReverseFutility bool
+	// CheckExtensions searches positions in check one ply deeper, so the
+	// search does not stop in the middle of a forcing sequence
+	CheckExtensions bool
+}
+
+// DefaultSearchOptions returns the options of a new AI, with everything enabled
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		NullMove:           true,
+		LateMoveReductions: true,
+		Futility:           true,
+		ReverseFutility:    true,
+		CheckExtensions:    true,
+	}
+}
+
+// SetOptions changes the selective search techniques the AI uses
+func (ai *AI) SetOptions(options SearchOptions) {
+	ai.options = options
+}
+
+// Options returns the selective search techniques the AI uses
+func (ai *AI) Options() SearchOptions {
+	return ai.options
+}
+
+// hasPieces reports whether the player has any pieces besides the king and
+// pawns. Without them zugzwang is common, so null moves are not tried.
+func hasPieces(game *Game, player Color) bool {
+	pieces := game.Board.pieces[player]
+	return pieces[Queen]|pieces[Rook]|pieces[Bishop]|pieces[Knight] != 0
+}
+
+// lateMoveReduction returns how many plies less to search the move at the
+// given index of the move order, for a quiet move that does not give check
+func lateMoveReduction(depth, index int) int {
+	if depth < lateMoveMinDepth || index < lateMoveIndex {
+		return 0
+	}
+	if depth >= lateMoveDeepDepth && index >= lateMoveDeepIndex {
+		return 2
+	}
+	return 1
+}
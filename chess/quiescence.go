@@ -0,0 +1,108 @@
+package chess
+
+import (
+	"math"
+	"sort"
+)
+
+// deltaMargin allows for the positional gain of a capture when delta pruning
+// decides whether winning the captured piece could still matter
+const deltaMargin = 2.0
+
+// quiescence continues the search at the leaves through captures and
+// promotions until the position is quiet, so that it is never evaluated in
+// the middle of an exchange. The side to move may "stand pat" and accept the
+// static evaluation instead of capturing, except when in check, where every
+// evasion is searched. Like negamax, it scores the position for the side to
+// move.
+func (ai *AI) quiescence(game *Game, alpha, beta float64, ply int) float64 {
+	ai.nodes++
+	if ai.shouldStop() {
+		return 0
+	}
+
+	if game.State == Checkmate {
+		return -mateScore + float64(ply)
+	}
+	if game.IsGameOver() {
+		return 0
+	}
+
+	inCheck := game.State == Check
+	bestScore := math.Inf(-1)
+
+	var moves []Move
+	var standPat float64
+	if inCheck {
+		moves = game.LegalMoves()
+	} else {
+		standPat = ai.evaluate(game)
+		if standPat >= beta {
+			return standPat
+		}
+		alpha = math.Max(alpha, standPat)
+		bestScore = standPat
+		moves = game.tacticalMoves()
+	}
+
+	for _, move := range ai.orderCaptures(moves, game) {
+		// Delta pruning: skip captures that cannot reach alpha even if the
+		// captured piece is won outright
+		if !inCheck && standPat+ai.materialGain(game, move)+deltaMargin <= alpha {
+			continue
+		}
+
+		game.makeMove(move)
+		score := -ai.quiescence(game, -beta, -alpha, ply+1)
+		game.unmakeLastMove()
+		if ai.stopped {
+			return 0
+		}
+
+		bestScore = math.Max(bestScore, score)
+		alpha = math.Max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+
+	return bestScore
+}
+
+// materialGain returns the material a capture or promotion wins, in pawns
+func (ai *AI) materialGain(game *Game, move Move) float64 {
+	gain := 0.0
+	if victim := game.Board.GetPiece(move.To); victim != nil {
+		gain += pieceValues[victim.Type]
+	} else if game.IsEnPassantMove(move) {
+		gain += pieceValues[Pawn]
+	}
+	if move.Promotion != NoPromotion {
+		gain += pieceValues[move.Promotion] - pieceValues[Pawn]
+	}
+	return gain
+}
+
+// orderCaptures sorts captures by the most valuable victim first and, among
+// equal victims, the least valuable attacker first (MVV-LVA)
+func (ai *AI) orderCaptures(moves []Move, game *Game) []Move {
+	keys := make([]float64, len(moves))
+	for i, move := range moves {
+		keys[i] = ai.materialGain(game, move)*10 - pieceValues[game.Board.GetPiece(move.From).Type]
+	}
+	sort.Sort(byKey{moves, keys})
+	return moves
+}
+
+// byKey sorts moves by descending keys
+type byKey struct {
+	moves []Move
+	keys  []float64
+}
+
+func (b byKey) Len() int           { return len(b.moves) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.moves[i], b.moves[j] = b.moves[j], b.moves[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
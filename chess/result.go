@@ -0,0 +1,205 @@
+package chess
+
+import "errors"
+
+var (
+	// ErrGameOver is returned when trying to move, resign or offer a draw in a finished game
+	ErrGameOver = errors.New("game is over")
+	// ErrNoDrawOffer is returned by AcceptDraw and DeclineDraw when no draw has been offered
+	ErrNoDrawOffer = errors.New("no draw offer to answer")
+	// ErrOwnDrawOffer is returned by AcceptDraw when the player who offered the draw tries to accept it
+	ErrOwnDrawOffer = errors.New("cannot accept your own draw offer")
+)
+
+// Result is the outcome of a game
+type Result int
+
+const (
+	// NoResult indicates the game is still in progress
+	NoResult Result = iota
+	// WhiteWins indicates White won the game
+	WhiteWins
+	// BlackWins indicates Black won the game
+	BlackWins
+	// Drawn indicates the game ended in a draw
+	Drawn
+)
+
+// String returns the result as written in PGN: "1-0", "0-1", "1/2-1/2" or "*"
+func (r Result) String() string {
+	switch r {
+	case NoResult:
+		return "*"
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Drawn:
+		return "1/2-1/2"
+	default:
+		return UnknownValue
+	}
+}
+
+// winResult returns the result of a game won by the given player
+func winResult(winner Color) Result {
+	if winner == White {
+		return WhiteWins
+	}
+	return BlackWins
+}
+
+// Termination describes how a game ended
+type Termination int
+
+const (
+	// Unterminated indicates the game is still in progress
+	Unterminated Termination = iota
+	// ByCheckmate indicates the game ended in checkmate
+	ByCheckmate
+	// ByStalemate indicates the game ended in stalemate
+	ByStalemate
+	// ByResignation indicates a player resigned
+	ByResignation
+	// ByTimeout indicates a player ran out of time
+	ByTimeout
+	// ByAgreement indicates the players agreed to a draw
+	ByAgreement
+	// ByRepetition indicates a draw by threefold or fivefold repetition
+	ByRepetition
+	// ByMoveRule indicates a draw by the fifty-move or seventy-five-move rule
+	ByMoveRule
+	// ByInsufficientMaterial indicates a draw because neither side can checkmate
+	ByInsufficientMaterial
+)
+
+func (t Termination) String() string {
+	switch t {
+	case Unterminated:
+		return "unterminated"
+	case ByCheckmate:
+		return "checkmate"
+	case ByStalemate:
+		return "stalemate"
+	case ByResignation:
+		return "resignation"
+	case ByTimeout:
+		return "timeout"
+	case ByAgreement:
+		return "agreement"
+	case ByRepetition:
+		return "repetition"
+	case ByMoveRule:
+		return "move rule"
+	case ByInsufficientMaterial:
+		return "insufficient material"
+	default:
+		return UnknownValue
+	}
+}
+
+// Result returns the outcome of the game, or NoResult while it is in progress
+func (g *Game) Result() Result {
+	switch g.State {
+	case Checkmate:
+		return winResult(g.CurrentPlayer.Opponent())
+	case Resigned:
+		return winResult(g.loser.Opponent())
+	case TimeForfeit:
+		// Running out of time only loses if the opponent could still checkmate
+		if !g.Board.canCheckmate(g.loser.Opponent()) {
+			return Drawn
+		}
+		return winResult(g.loser.Opponent())
+	case Stalemate, Draw:
+		return Drawn
+	}
+	return NoResult
+}
+
+// Termination returns how the game ended, or Unterminated while it is in progress
+func (g *Game) Termination() Termination {
+	switch g.State {
+	case Checkmate:
+		return ByCheckmate
+	case Stalemate:
+		return ByStalemate
+	case Resigned:
+		return ByResignation
+	case TimeForfeit:
+		return ByTimeout
+	case Draw:
+		switch g.DrawReason {
+		case Agreement:
+			return ByAgreement
+		case ThreefoldRepetition, FivefoldRepetition:
+			return ByRepetition
+		case FiftyMoveRule, SeventyFiveMoveRule:
+			return ByMoveRule
+		case InsufficientMaterial:
+			return ByInsufficientMaterial
+		}
+	}
+	return Unterminated
+}
+
+// Resign ends the game with a win for the opponent of the given player, who
+// may resign on either player's turn
+func (g *Game) Resign(player Color) error {
+	if g.IsGameOver() {
+		return ErrGameOver
+	}
+
+	g.State = Resigned
+	g.loser = player
+	g.drawOffer = nil
+	return nil
+}
+
+// OfferDraw records a draw offer by the given player. The offer stands until
+// the opponent accepts or declines it, or declines implicitly by moving.
+func (g *Game) OfferDraw(player Color) error {
+	if g.IsGameOver() {
+		return ErrGameOver
+	}
+
+	g.drawOffer = &player
+	return nil
+}
+
+// DrawOffer returns the player whose draw offer is pending, if any
+func (g *Game) DrawOffer() (Color, bool) {
+	if g.drawOffer == nil {
+		return White, false
+	}
+	return *g.drawOffer, true
+}
+
+// AcceptDraw accepts the opponent's pending draw offer on behalf of the given
+// player and ends the game as a draw by agreement
+func (g *Game) AcceptDraw(player Color) error {
+	if g.IsGameOver() {
+		return ErrGameOver
+	}
+	if g.drawOffer == nil {
+		return ErrNoDrawOffer
+	}
+	if *g.drawOffer == player {
+		return ErrOwnDrawOffer
+	}
+
+	g.State = Draw
+	g.DrawReason = Agreement
+	g.drawOffer = nil
+	return nil
+}
+
+// DeclineDraw withdraws the pending draw offer
+func (g *Game) DeclineDraw() error {
+	if g.drawOffer == nil {
+		return ErrNoDrawOffer
+	}
+
+	g.drawOffer = nil
+	return nil
+}
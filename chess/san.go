@@ -0,0 +1,190 @@
+package chess
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SAN returns the move in Standard Algebraic Notation (e.g., "Nbd7", "exd6",
+// "O-O" or "e8=Q+"), including the check or mate suffix. A move that is not
+// legal in the current position is returned in coordinate notation instead.
+func (g *Game) SAN(move Move) string {
+	if !g.IsLegal(move) {
+		return move.String()
+	}
+
+	next := g.clone()
+	if err := next.ApplyMove(move); err != nil {
+		return move.String()
+	}
+	return g.sanBase(move) + sanSuffix(next)
+}
+
+// SANLine returns a line of moves, such as a principal variation, in
+// Standard Algebraic Notation, each move written for the position the moves
+// before it lead to. The line stops at the first move that is not legal.
+func (g *Game) SANLine(moves []Move) []string {
+	position := g.clone()
+	var line []string
+	for _, move := range moves {
+		if !position.IsLegal(move) {
+			break
+		}
+		line = append(line, position.SAN(move))
+		position.makeMove(move)
+	}
+	return line
+}
+
+// sanBase returns the move in Standard Algebraic Notation without a check or mate suffix
+func (g *Game) sanBase(move Move) string {
+	piece := g.Board.GetPiece(move.From)
+	if piece == nil {
+		return move.String()
+	}
+
+	if g.Board.IsCastlingMove(move) {
+		if move.To.Col > move.From.Col {
+			return "O-O"
+		}
+		return "O-O-O"
+	}
+
+	var sb strings.Builder
+	isCapture := g.Board.GetPiece(move.To) != nil || g.IsEnPassantMove(move)
+
+	if piece.Type == Pawn {
+		if isCapture {
+			sb.WriteByte(move.From.String()[0])
+		}
+	} else {
+		sb.WriteString(piece.Type.Letter())
+		sb.WriteString(g.sanDisambiguation(move, piece))
+	}
+
+	if isCapture {
+		sb.WriteString("x")
+	}
+	sb.WriteString(move.To.String())
+
+	if move.Promotion != NoPromotion {
+		sb.WriteString("=")
+		sb.WriteString(move.Promotion.Letter())
+	}
+
+	return sb.String()
+}
+
+// sanDisambiguation returns the file, rank or square needed to tell the move
+// apart from moves of other pieces of the same type to the same square
+func (g *Game) sanDisambiguation(move Move, piece *Piece) string {
+	sameFile, sameRank, ambiguous := false, false, false
+	for _, other := range g.LegalMoves() {
+		if other.To != move.To || other.From == move.From {
+			continue
+		}
+		otherPiece := g.Board.GetPiece(other.From)
+		if otherPiece == nil || otherPiece.Type != piece.Type {
+			continue
+		}
+		ambiguous = true
+		if other.From.Col == move.From.Col {
+			sameFile = true
+		}
+		if other.From.Row == move.From.Row {
+			sameRank = true
+		}
+	}
+
+	from := move.From.String()
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return from[:1]
+	case !sameRank:
+		return from[1:]
+	default:
+		return from
+	}
+}
+
+// sanSuffix returns "#" for checkmate, "+" for check and "" otherwise
+func sanSuffix(game *Game) string {
+	switch game.State {
+	case Checkmate:
+		return "#"
+	case Check:
+		return "+"
+	default:
+		return ""
+	}
+}
+
+// sanPattern matches a non-castling SAN move: piece, origin file and rank, capture, target and promotion
+var sanPattern = regexp.MustCompile(`^([KQRBN])?([a-h])?([1-8])?(x)?([a-h][1-8])(?:=?([QRBNqrbn]))?$`)
+
+// ParseSAN finds the legal move described by a move in Standard Algebraic
+// Notation. Check, mate and annotation suffixes are ignored, castling may be
+// written with zeros, and the "=" before a promotion piece is optional.
+func (g *Game) ParseSAN(san string) (Move, error) {
+	text := strings.TrimRight(san, "+#!?")
+
+	switch text {
+	case "O-O", "0-0":
+		return g.findCastlingMove(san, 6)
+	case "O-O-O", "0-0-0":
+		return g.findCastlingMove(san, 2)
+	}
+
+	parts := sanPattern.FindStringSubmatch(text)
+	if parts == nil {
+		return Move{}, fmt.Errorf("invalid SAN move: %q", san)
+	}
+
+	pieceType := Pawn
+	if parts[1] != "" {
+		pieceType = pieceFromFEN(rune(parts[1][0])).Type
+	}
+	to, _ := FromAlgebraic(parts[5])
+	promotion := NoPromotion
+	if parts[6] != "" {
+		promotion = pieceFromFEN(rune(parts[6][0])).Type
+	}
+
+	var matches []Move
+	for _, move := range g.LegalMoves() {
+		piece := g.Board.GetPiece(move.From)
+		if move.To != to || piece.Type != pieceType || move.Promotion != promotion {
+			continue
+		}
+		from := move.From.String()
+		if (parts[2] != "" && parts[2][0] != from[0]) || (parts[3] != "" && parts[3][0] != from[1]) {
+			continue
+		}
+		matches = append(matches, move)
+	}
+
+	switch len(matches) {
+	case 0:
+		if pieceType == Pawn && promotion == NoPromotion && (to.Row == 0 || to.Row == 7) {
+			return Move{}, fmt.Errorf("%w: %q", ErrPromotionRequired, san)
+		}
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, san)
+	case 1:
+		return matches[0], nil
+	default:
+		return Move{}, fmt.Errorf("ambiguous SAN move: %q", san)
+	}
+}
+
+// findCastlingMove returns the legal castling move of the current player's king to the given column
+func (g *Game) findCastlingMove(san string, col int) (Move, error) {
+	for _, move := range g.LegalMoves() {
+		if move.To.Col == col && g.Board.IsCastlingMove(move) {
+			return move, nil
+		}
+	}
+	return Move{}, fmt.Errorf("%w: %q", ErrInvalidMove, san)
+}
@@ -0,0 +1,268 @@
+package chess
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// MaxSearchDepth is the deepest a search goes when its limits set no depth
+const MaxSearchDepth = 64
+
+// Limits bounds a search. Zero fields set no limit. A search without a depth,
+// node or time limit runs until its context is cancelled.
+type Limits struct {
+	Depth     int           // maximum depth in plies
+	Nodes     uint64        // maximum number of positions to visit
+	MoveTime  time.Duration // time to spend on the move
+	Time      time.Duration // remaining time on the clock of the side to move
+	Increment time.Duration // time added to that clock after each move
+	MovesToGo int           // moves until the next time control, 0 if it lasts the game
+}
+
+// budget returns how long the search may take, or 0 for no time limit. On a
+// clock it spends an even share of the remaining time over the moves to go
+// (30 when unknown) plus most of the increment, and never more than half of
+// what is left.
+func (l Limits) budget() time.Duration {
+	if l.MoveTime > 0 {
+		return l.MoveTime
+	}
+	if l.Time <= 0 {
+		return 0
+	}
+
+	movesToGo := l.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = 30
+	}
+	budget := l.Time/time.Duration(movesToGo) + l.Increment*3/4
+	if budget > l.Time/2 {
+		budget = l.Time / 2
+	}
+	return budget
+}
+
+// Limits returns the search limits for the player's next move on this clock.
+// A Bronstein delay is spent like an increment.
+func (c *Clock) Limits(player Color) Limits {
+	period := c.currentPeriod(player)
+	return Limits{
+		Time:      c.Remaining(player),
+		Increment: period.Increment + period.Delay,
+		MovesToGo: c.MovesToGo(player),
+	}
+}
+
+// aspirationWindow is how far, in pawns, the score of an iteration may
+// differ from the previous one before the iteration is searched again with a
+// wider window
+const aspirationWindow = 0.5
+
+// SearchResult describes the outcome of a search, or of one of its completed
+// iterations
+type SearchResult struct {
+	Move  Move    // the best move, which starts the principal variation
+	Score float64 // in pawns, from the point of view of the AI's color
+	Depth int     // depth of the deepest completed iteration
+	PV    []Move  // principal variation: the line of best play found
+	Lines []Line  // the best lines, best first, as many as the AI's MultiPV
+	Nodes uint64
+	Time  time.Duration
+}
+
+// MateIn returns the number of moves to a forced mate found by the search,
+// negative when the AI is the side getting mated
+func (r SearchResult) MateIn() (int, bool) {
+	return mateIn(r.Score)
+}
+
+// mateIn returns the number of moves to the mate a score stands for, if any
+func mateIn(score float64) (int, bool) {
+	plies := int(math.Round(mateScore - math.Abs(score)))
+	if plies > MaxSearchDepth {
+		return 0, false
+	}
+	moves := (plies + 1) / 2
+	if score < 0 {
+		moves = -moves
+	}
+	return moves, true
+}
+
+// Search looks for the AI's best move by iterative deepening until a limit is
+// reached or the context is done. The result is that of the deepest completed
+// iteration, or if not even the first one completes, the best move found so
+// far. It returns false when the AI has no move to make.
+func (ai *AI) Search(ctx context.Context, game *Game, limits Limits) (SearchResult, bool) {
+	if game.CurrentPlayer != ai.color {
+		return SearchResult{}, false
+	}
+
+	allMoves := ai.getAllPossibleMoves(game)
+	if len(allMoves) == 0 {
+		return SearchResult{}, false
+	}
+
+	start := time.Now()
+	if budget := limits.budget(); budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	maxDepth := limits.Depth
+	if maxDepth <= 0 || maxDepth > MaxSearchDepth {
+		maxDepth = MaxSearchDepth
+	}
+
+	// Clear killer moves for new search
+	ai.killerMoves = [10][2]Move{}
+	ai.nodes = 0
+	ai.done, ai.nodeLimit, ai.stopped = ctx.Done(), limits.Nodes, false
+	defer func() { ai.done = nil }()
+
+	if ai.transpositionTable == nil {
+		ai.transpositionTable = NewTranspositionTable(DefaultHashSize)
+	}
+	ai.transpositionTable.newSearch()
+
+	stopHelpers := ai.startHelpers(game, maxDepth)
+	// The search plays moves on its own copy of the game and takes them back
+	result := ai.iterativeDeepening(ai.copyGame(game), allMoves[0], 1, maxDepth, start)
+	ai.nodes = stopHelpers()
+
+	result.Nodes = ai.nodes
+	result.Time = time.Since(start)
+	return result, true
+}
+
+// iterativeDeepening searches the game from firstDepth up to maxDepth, one
+// ply more each iteration, until the search is stopped. Each completed
+// iteration replaces the result of the last, as it looked further. If the
+// first iteration does not complete, the result has its best move so far,
+// or else fallback.
+func (ai *AI) iterativeDeepening(game *Game, fallback Move, firstDepth, maxDepth int, start time.Time) SearchResult {
+	ai.pv = nil
+	ai.rootPosition = len(game.positionHashes) - 1
+	result := SearchResult{Move: fallback, PV: []Move{fallback}, Lines: []Line{{PV: []Move{fallback}}}}
+
+	for depth := firstDepth; depth <= maxDepth; depth++ {
+		lines := ai.searchLines(game, depth, result.Lines)
+
+		if ai.stopped {
+			// A partly searched first iteration still beats an arbitrary move
+			if depth == firstDepth && len(lines) == 0 && ai.pvLength[0] > 0 {
+				lines = []Line{{PV: ai.principalVariation()}}
+			}
+			if depth == firstDepth && len(lines) > 0 {
+				result.Move = lines[0].PV[0]
+				result.PV = lines[0].PV
+				result.Lines = lines
+			}
+			break
+		}
+
+		ai.pv = lines[0].PV
+		result = SearchResult{
+			Move:  ai.pv[0],
+			Score: lines[0].Score,
+			Depth: depth,
+			PV:    ai.pv,
+			Lines: lines,
+			Nodes: ai.searchedNodes(),
+			Time:  time.Since(start),
+		}
+		if ai.onIteration != nil {
+			ai.onIteration(result)
+		}
+
+		// Searching deeper cannot improve on a forced mate found within this
+		// depth, unless there are more lines to rank
+		if ai.MultiPV() == 1 && result.Score >= mateScore-float64(depth) {
+			break
+		}
+	}
+
+	return result
+}
+
+// aspirationSearch searches the root to the given depth. Scores rarely change
+// much from one iteration to the next, so the search starts with a narrow
+// window around the previous score, which prunes more, and widens it on the
+// failing side whenever the score falls outside.
+func (ai *AI) aspirationSearch(game *Game, depth int, previous float64) float64 {
+	alpha, beta := math.Inf(-1), math.Inf(1)
+	delta := aspirationWindow
+	if depth > 1 && math.Abs(previous) < mateScore-MaxSearchDepth {
+		alpha, beta = previous-delta, previous+delta
+	}
+
+	for {
+		score := ai.negamax(game, depth, alpha, beta, 0, true)
+		if ai.stopped {
+			return 0
+		}
+
+		switch {
+		case score <= alpha:
+			alpha = score - delta
+		case score >= beta:
+			beta = score + delta
+		default:
+			return score
+		}
+
+		// After a few failures the score has moved too far to guess
+		delta *= 2
+		if delta >= 8*aspirationWindow {
+			alpha, beta = math.Inf(-1), math.Inf(1)
+		}
+	}
+}
+
+// updatePV makes the move followed by the line found from the next ply the
+// principal variation from the given ply
+func (ai *AI) updatePV(ply int, move Move) {
+	ai.pvTable[ply][ply] = move
+	next := ai.pvLength[ply+1]
+	copy(ai.pvTable[ply][ply+1:next], ai.pvTable[ply+1][ply+1:next])
+	ai.pvLength[ply] = next
+}
+
+// principalVariation returns a copy of the line found from the root
+func (ai *AI) principalVariation() []Move {
+	pv := make([]Move, ai.pvLength[0])
+	copy(pv, ai.pvTable[0][:ai.pvLength[0]])
+	return pv
+}
+
+// OnIteration registers a function called after each completed iteration of
+// a search, for example to report progress. Pass nil to remove it.
+func (ai *AI) OnIteration(fn func(SearchResult)) {
+	ai.onIteration = fn
+}
+
+// shouldStop reports whether the search has reached its node limit, its
+// context is done or, in a parallel search, the main thread has finished.
+// Only the node limit is checked at every node; the rest is polled every
+// 1024 nodes, when the threads of a parallel search also publish their node
+// counts, to keep the check cheap.
+func (ai *AI) shouldStop() bool {
+	if ai.stopped {
+		return true
+	}
+	if ai.nodeLimit > 0 && ai.searchedNodes() >= ai.nodeLimit {
+		ai.stopped = true
+	} else if ai.nodes&1023 == 0 {
+		if ai.shared != nil {
+			ai.publishNodes()
+			ai.stopped = ai.shared.stop.Load()
+		}
+		select {
+		case <-ai.done:
+			ai.stopped = true
+		default:
+		}
+	}
+	return ai.stopped
+}
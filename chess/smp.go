@@ -0,0 +1,92 @@
+package chess
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharedSearch is what the threads of a parallel search share besides the
+// transposition table
+type sharedSearch struct {
+	stop  atomic.Bool   // set once the main thread has its result
+	nodes atomic.Uint64 // positions visited by all threads, published in batches
+}
+
+// SetThreads sets how many threads a search uses, at least one. With more,
+// the search runs Lazy SMP: helper threads search the same position at the
+// same time, on their own copies of the game and with their own move
+// ordering, but sharing the transposition table, so the positions one thread
+// stores there save the others from searching them. Only the main thread's
+// result is used. A single thread, the default, searches deterministically.
+func (ai *AI) SetThreads(threads int) {
+	ai.threads = max(threads, 1)
+}
+
+// Threads returns how many threads a search uses
+func (ai *AI) Threads() int {
+	return max(ai.threads, 1)
+}
+
+// startHelpers starts the helper threads of a parallel search on the game,
+// searching up to maxDepth. The returned function stops them, waits for them
+// to finish and returns the number of positions all threads visited. With a
+// single thread it starts nothing.
+func (ai *AI) startHelpers(game *Game, maxDepth int) func() uint64 {
+	ai.shared, ai.published = nil, 0
+	if ai.Threads() == 1 {
+		return func() uint64 { return ai.nodes }
+	}
+
+	shared := &sharedSearch{}
+	ai.shared = shared
+	var wg sync.WaitGroup
+	for i := 1; i < ai.Threads(); i++ {
+		helper := &AI{
+			color:              ai.color,
+			depth:              ai.depth,
+			transpositionTable: ai.transpositionTable,
+			historyTable:       make(map[Move]int),
+			options:            ai.options,
+			done:               ai.done,
+			nodeLimit:          ai.nodeLimit,
+			shared:             shared,
+		}
+		helperGame := ai.copyGame(game)
+
+		// Starting half the helpers a ply deeper spreads the threads over
+		// different depths, so they store more that the others can use
+		firstDepth := min(1+i%2, maxDepth)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			moves := helperGame.LegalMoves()
+			helper.iterativeDeepening(helperGame, moves[0], firstDepth, maxDepth, time.Now())
+			helper.publishNodes()
+		}()
+	}
+
+	return func() uint64 {
+		shared.stop.Store(true)
+		wg.Wait()
+		ai.publishNodes()
+		return shared.nodes.Load()
+	}
+}
+
+// publishNodes adds the positions the thread visited since it last did so to
+// the shared count
+func (ai *AI) publishNodes() {
+	ai.shared.nodes.Add(ai.nodes - ai.published)
+	ai.published = ai.nodes
+}
+
+// searchedNodes returns the positions visited so far by the search, in all
+// threads. Other threads' positions are counted as they publish them.
+func (ai *AI) searchedNodes() uint64 {
+	if ai.shared == nil {
+		return ai.nodes
+	}
+	return ai.shared.nodes.Load() + ai.nodes - ai.published
+}
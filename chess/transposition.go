@@ -0,0 +1,219 @@
+package chess
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// DefaultHashSize is the size of a new AI's transposition table in MB
+const DefaultHashSize = 16
+
+// TranspositionEntry represents an entry in the transposition table
+type TranspositionEntry struct {
+	depth int
+	score float64
+	flag  int  // 0 = exact, 1 = lower bound, 2 = upper bound
+	move  Move // best move found, the zero Move when none is known
+	age   int  // generation of the search that stored the entry
+}
+
+// hasMove reports whether the entry knows a best move for its position
+func (e TranspositionEntry) hasMove() bool {
+	return e.move.From != e.move.To
+}
+
+// Layout of an entry packed into 64 bits. The score is kept as a float32,
+// which is exact for mate scores and far finer than the null window
+// otherwise. A move takes 15 bits: 6 for each square and 3 for the promotion.
+const (
+	entryDepthShift = 32      // 7 bits
+	entryFlagShift  = 39      // 2 bits
+	entryMoveShift  = 41      // 15 bits
+	entryAgeShift   = 56      // 6 bits
+	entryUsed       = 1 << 62 // set in every stored entry, so an empty slot never matches
+
+	maxEntryDepth = 1<<7 - 1
+	ageMask       = 1<<6 - 1
+)
+
+// pack returns the entry as 64 bits
+func (e TranspositionEntry) pack() uint64 {
+	move := uint64(squareIndex(e.move.From)) | uint64(squareIndex(e.move.To))<<6 | uint64(e.move.Promotion)<<12
+	return uint64(math.Float32bits(float32(e.score))) |
+		uint64(min(e.depth, maxEntryDepth))<<entryDepthShift |
+		uint64(e.flag&3)<<entryFlagShift |
+		move<<entryMoveShift |
+		uint64(e.age&ageMask)<<entryAgeShift |
+		entryUsed
+}
+
+// unpackEntry reverses pack
+func unpackEntry(data uint64) TranspositionEntry {
+	move := data >> entryMoveShift
+	return TranspositionEntry{
+		depth: int(data >> entryDepthShift & maxEntryDepth),
+		score: float64(math.Float32frombits(uint32(data))),
+		flag:  int(data >> entryFlagShift & 3),
+		move: Move{
+			From:      squarePosition(int(move & 63)),
+			To:        squarePosition(int(move >> 6 & 63)),
+			Promotion: PieceType(move >> 12 & 7),
+		},
+		age: int(data >> entryAgeShift & ageMask),
+	}
+}
+
+// TranspositionTable caches search results by position hash, in a fixed
+// amount of memory that can be kept from one search to the next. The
+// threads of a parallel search use it at once without locks.
+//
+// Positions map to buckets of two entries. The first keeps the deepest
+// result, which saves the most work, unless it is left over from an earlier
+// search; the second always takes the newest result that the first did not.
+// Each entry is held in two atomic words, the packed entry and the position
+// hash XORed with it, which verifies the key: an entry torn by two threads
+// writing the slot together does not match the hash and is ignored.
+type TranspositionTable struct {
+	buckets []tableBucket
+	mask    uint64
+	age     int // generation of the current search
+}
+
+// tableBucket holds the depth-preferred and always-replace entries of a bucket
+type tableBucket [2]tableSlot
+
+// tableSlot holds one entry of the transposition table
+type tableSlot struct {
+	check atomic.Uint64 // the position hash XOR data
+	data  atomic.Uint64 // the packed entry
+}
+
+// bucketSize is the memory a bucket takes, in bytes
+const bucketSize = 32
+
+// NewTranspositionTable creates a table taking at most the given number of
+// MB, and at least one bucket
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+	buckets := 1
+	for buckets*2*bucketSize <= megabytes<<20 {
+		buckets *= 2
+	}
+	return &TranspositionTable{
+		buckets: make([]tableBucket, buckets),
+		mask:    uint64(buckets - 1),
+	}
+}
+
+// Clear removes every entry, for example before a new game
+func (t *TranspositionTable) Clear() {
+	for i := range t.buckets {
+		for j := range t.buckets[i] {
+			t.buckets[i][j].check.Store(0)
+			t.buckets[i][j].data.Store(0)
+		}
+	}
+	t.age = 0
+}
+
+// Hashfull returns how full the table is in permille, counting the entries
+// of the current search in a sample of up to 1000
+func (t *TranspositionTable) Hashfull() int {
+	sample := min(len(t.buckets), 500)
+	used := 0
+	for i := range sample {
+		for j := range t.buckets[i] {
+			data := t.buckets[i][j].data.Load()
+			if data&entryUsed != 0 && unpackEntry(data).age == t.age {
+				used++
+			}
+		}
+	}
+	return used * 1000 / (sample * 2)
+}
+
+// newSearch starts a new generation of entries. Entries of earlier searches
+// are still found but are the first to be replaced.
+func (t *TranspositionTable) newSearch() {
+	t.age = (t.age + 1) & ageMask
+}
+
+// load returns the entry in the slot if it is for the position hash
+func (s *tableSlot) load(hash uint64) (TranspositionEntry, bool) {
+	data := s.data.Load()
+	if data&entryUsed == 0 || s.check.Load()^data != hash {
+		return TranspositionEntry{}, false
+	}
+	return unpackEntry(data), true
+}
+
+// save puts the entry for the position hash in the slot
+func (s *tableSlot) save(hash uint64, entry TranspositionEntry) {
+	data := entry.pack()
+	s.check.Store(hash ^ data)
+	s.data.Store(data)
+}
+
+// probe returns the entry stored for the position hash, if any
+func (t *TranspositionTable) probe(hash uint64) (TranspositionEntry, bool) {
+	bucket := &t.buckets[hash&t.mask]
+	for i := range bucket {
+		if entry, ok := bucket[i].load(hash); ok {
+			return entry, true
+		}
+	}
+	return TranspositionEntry{}, false
+}
+
+// store saves the entry for the position hash. An entry without a best move
+// keeps the one already known for the position.
+func (t *TranspositionTable) store(hash uint64, entry TranspositionEntry) {
+	bucket := &t.buckets[hash&t.mask]
+	entry.age = t.age
+
+	slot := &bucket[1]
+	if t.prefers(&bucket[0], hash, entry) {
+		slot = &bucket[0]
+	}
+	if old, ok := slot.load(hash); ok && !entry.hasMove() {
+		entry.move = old.move
+	}
+	slot.save(hash, entry)
+}
+
+// prefers reports whether the entry for the position hash belongs in the
+// depth-preferred slot: the slot is empty, already holds the position, is
+// left over from an earlier search or holds a result no deeper
+func (t *TranspositionTable) prefers(slot *tableSlot, hash uint64, entry TranspositionEntry) bool {
+	data := slot.data.Load()
+	if data&entryUsed == 0 || slot.check.Load()^data == hash {
+		return true
+	}
+	old := unpackEntry(data)
+	return old.age != t.age || entry.depth >= old.depth
+}
+
+// scoreToTable converts a score found at the given ply for storing in the
+// transposition table. Mate scores count plies from the root, but the same
+// position can be reached at another ply, so they are stored counting from
+// the position itself.
+func scoreToTable(score float64, ply int) float64 {
+	switch {
+	case score >= mateScore-MaxSearchDepth:
+		return score + float64(ply)
+	case score <= -mateScore+MaxSearchDepth:
+		return score - float64(ply)
+	}
+	return score
+}
+
+// scoreFromTable converts a score stored in the transposition table back to
+// one counting mates from the root
+func scoreFromTable(score float64, ply int) float64 {
+	switch {
+	case score >= mateScore-MaxSearchDepth:
+		return score - float64(ply)
+	case score <= -mateScore+MaxSearchDepth:
+		return score + float64(ply)
+	}
+	return score
+}
@@ -0,0 +1,104 @@
+package chess
+
+// moveRecord stores everything a move changed so that it can be taken back
+type moveRecord struct {
+	move            Move
+	piece           *Piece // the piece that moved, before any promotion
+	pieceHasMoved   bool
+	captured        *Piece
+	capturePos      Position
+	rookHasMoved    bool // castling rook's flag before the move
+	enPassantTarget *Position
+	halfmoveClock   int
+	fullmoveNumber  int
+	state           GameState
+	drawReason      DrawReason
+	drawOffer       *Color
+}
+
+// CanUndo reports whether there is a move to take back
+func (g *Game) CanUndo() bool {
+	return len(g.undoRecords) > 0
+}
+
+// CanRedo reports whether there is an undone move to replay, which there is
+// not once the game is over
+func (g *Game) CanRedo() bool {
+	return len(g.redoMoves) > 0 && !g.IsGameOver()
+}
+
+// UndoMove takes back the last move, restoring captured pieces, HasMoved
+// flags, castling and en passant state, the player to move and the game state
+func (g *Game) UndoMove() error {
+	if !g.CanUndo() {
+		return ErrNothingToUndo
+	}
+
+	record := g.unmakeLastMove()
+	g.redoMoves = append(g.redoMoves, record.move)
+
+	return nil
+}
+
+// RedoMove replays the most recently undone move. A game ended after the
+// move was undone, by resignation, agreement, a claim or on time, stays over.
+func (g *Game) RedoMove() error {
+	if g.IsGameOver() {
+		return ErrGameOver
+	}
+	if !g.CanRedo() {
+		return ErrNothingToRedo
+	}
+
+	move := g.redoMoves[len(g.redoMoves)-1]
+	if err := g.validateMove(move); err != nil {
+		// The position no longer matches the undone move; drop the stale redo history
+		g.redoMoves = nil
+		return err
+	}
+
+	g.redoMoves = g.redoMoves[:len(g.redoMoves)-1]
+	g.makeMove(move)
+
+	return nil
+}
+
+// unmakeLastMove takes back the last move made with makeMove and returns its
+// record. Together with makeMove it lets the search walk the game tree in
+// place without allocating.
+func (g *Game) unmakeLastMove() moveRecord {
+	record := g.undoRecords[len(g.undoRecords)-1]
+	g.undoRecords = g.undoRecords[:len(g.undoRecords)-1]
+	g.MoveHistory = g.MoveHistory[:len(g.MoveHistory)-1]
+	g.positionHashes = g.positionHashes[:len(g.positionHashes)-1]
+
+	g.takeBack(record)
+	g.State = record.state
+	g.DrawReason = record.drawReason
+	g.drawOffer = record.drawOffer
+
+	return record
+}
+
+// takeBack reverses playMove
+func (g *Game) takeBack(record moveRecord) {
+	move := record.move
+
+	// The moving piece goes back as it was, which also reverts a promotion
+	g.Board.SetPiece(move.To, nil)
+	g.Board.SetPiece(move.From, record.piece)
+	record.piece.HasMoved = record.pieceHasMoved
+	g.Board.SetPiece(record.capturePos, record.captured)
+
+	if g.Board.IsCastlingMove(move) {
+		rook := g.Board.GetPiece(CastlingRookTarget(move))
+		g.Board.SetPiece(CastlingRookTarget(move), nil)
+		g.Board.SetPiece(CastlingRookPosition(move), rook)
+		rook.HasMoved = record.rookHasMoved
+	}
+
+	g.CurrentPlayer = g.CurrentPlayer.Opponent()
+	g.EnPassantTarget = record.enPassantTarget
+	g.HalfmoveClock = record.halfmoveClock
+	g.FullmoveNumber = record.fullmoveNumber
+}
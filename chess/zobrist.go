@@ -0,0 +1,62 @@
+package chess
+
+// Zobrist keys, one random 64-bit number per feature of a position. A
+// position's hash is the XOR of the keys of its features, so moving a piece
+// only needs the keys of the squares it leaves and enters.
+var (
+	zobristPieces    [2][6][64]uint64
+	zobristBlack     uint64
+	zobristCastling  [16]uint64
+	zobristEnPassant [8]uint64
+)
+
+func init() {
+	// A fixed seed keeps hashes identical between runs
+	rng := zobristRand(0x9E3779B97F4A7C15)
+
+	for color := range zobristPieces {
+		for pieceType := range zobristPieces[color] {
+			for sq := range zobristPieces[color][pieceType] {
+				zobristPieces[color][pieceType][sq] = rng.next()
+			}
+		}
+	}
+	zobristBlack = rng.next()
+	for i := range zobristCastling {
+		zobristCastling[i] = rng.next()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = rng.next()
+	}
+}
+
+// zobristRand is a xorshift64* generator for the Zobrist keys
+type zobristRand uint64
+
+// next returns the next pseudo-random number
+func (r *zobristRand) next() uint64 {
+	*r ^= *r >> 12
+	*r ^= *r << 25
+	*r ^= *r >> 27
+	return uint64(*r) * 2685821657736338717
+}
+
+// Hash returns the Zobrist hash of the position: piece placement, side to
+// move, castling rights and en passant file. The en passant file only counts
+// when a legal en passant capture exists, so positions that repeat have equal
+// hashes. The placement part is updated incrementally as pieces move.
+func (g *Game) Hash() uint64 {
+	hash := g.Board.hash ^ zobristCastling[g.Board.CastlingRights()]
+	if g.CurrentPlayer == Black {
+		hash ^= zobristBlack
+	}
+
+	for _, move := range g.enPassantMoves(g.CurrentPlayer) {
+		if !g.leavesKingInCheck(move, g.CurrentPlayer) {
+			hash ^= zobristEnPassant[g.EnPassantTarget.Col]
+			break
+		}
+	}
+
+	return hash
+}
@@ -1,9 +1,48 @@
 // Package main provides the entry point for the chess game application.
 package main
 
-import "chess-game/ui"
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"chess-game/chess"
+	"chess-game/uci"
+	"chess-game/ui"
+	"chess-game/xboard"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "perft":
+			os.Exit(runPerft(os.Args[2:], os.Stdout))
+		case "uci":
+			if err := uci.NewEngine(os.Stdout).Run(os.Stdin); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "xboard":
+			if err := xboard.NewEngine(os.Stdout).Run(os.Stdin); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	timeControl := flag.String("time", "", "play on a clock, e.g. 5 (minutes), 3+2 (increment), 15d5 (delay) or 40/90+30,30+30")
+	flag.Parse()
+
 	gameInterface := ui.NewInterface()
+	if *timeControl != "" {
+		control, err := chess.ParseTimeControl(*timeControl)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		gameInterface.SetTimeControl(control)
+	}
 	gameInterface.Run()
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"chess-game/chess"
+)
+
+// runPerft implements the "perft" command. Without -fen it checks the
+// reference positions against their known node counts and returns a non-zero
+// exit code on any mismatch.
+func runPerft(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("perft", flag.ContinueOnError)
+	flags.SetOutput(out)
+	depth := flags.Int("depth", 4, "search depth in plies")
+	fen := flags.String("fen", "", "count nodes for this position instead of the reference positions")
+	divide := flags.Bool("divide", false, "with -fen, list the node count below each move")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *depth < 1 {
+		fmt.Fprintln(out, "perft: depth must be at least 1")
+		return 2
+	}
+
+	if *fen != "" {
+		return perftPosition(out, *fen, *depth, *divide)
+	}
+	return perftReference(out, *depth)
+}
+
+// perftPosition prints the perft count, and optionally the divide output, for one position
+func perftPosition(out io.Writer, fen string, depth int, divide bool) int {
+	game, err := chess.ParseFEN(fen)
+	if err != nil {
+		fmt.Fprintf(out, "perft: %v\n", err)
+		return 2
+	}
+
+	start := time.Now()
+	if !divide {
+		nodes := game.Perft(depth)
+		fmt.Fprintf(out, "Nodes: %d (%s)\n", nodes, time.Since(start).Round(time.Millisecond))
+		return 0
+	}
+
+	counts := game.Divide(depth)
+	moves := make([]chess.Move, 0, len(counts))
+	for move := range counts {
+		moves = append(moves, move)
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].String() < moves[j].String()
+	})
+
+	var total uint64
+	for _, move := range moves {
+		fmt.Fprintf(out, "%s: %d\n", move, counts[move])
+		total += counts[move]
+	}
+	fmt.Fprintf(out, "\nMoves: %d\nNodes: %d (%s)\n", len(moves), total, time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// perftRowFormat lays out one row of the reference position table
+const perftRowFormat = "%-16s %5v %12v %12v %8v  %s\n"
+
+// perftReference runs the reference positions up to the given depth
+func perftReference(out io.Writer, depth int) int {
+	fmt.Fprintf(out, perftRowFormat, "Position", "Depth", "Nodes", "Expected", "Time", "")
+
+	failures := 0
+	for _, position := range chess.PerftPositions {
+		game, err := chess.ParseFEN(position.FEN)
+		if err != nil {
+			fmt.Fprintf(out, "perft: %s: %v\n", position.Name, err)
+			return 2
+		}
+
+		// Positions without a known count that deep are run as deep as they go
+		positionDepth := depth
+		if positionDepth > len(position.Nodes) {
+			positionDepth = len(position.Nodes)
+		}
+		expected := position.Nodes[positionDepth-1]
+
+		start := time.Now()
+		nodes := game.Perft(positionDepth)
+		status := "ok"
+		if nodes != expected {
+			status = "FAIL"
+			failures++
+		}
+		fmt.Fprintf(out, perftRowFormat, position.Name, positionDepth, nodes, expected,
+			time.Since(start).Round(time.Millisecond), status)
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(out, "%d of %d positions failed\n", failures, len(chess.PerftPositions))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,397 @@
+// Package uci implements the Universal Chess Interface, the text protocol
+// chess GUIs such as Arena and Cute Chess use to talk to engines.
+package uci
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chess-game/chess"
+)
+
+// Engine identification sent in reply to "uci"
+const (
+	engineName   = "chess-game"
+	engineAuthor = "the chess-game authors"
+)
+
+// Option defaults and limits
+const (
+	defaultHash    = 16
+	maxHash        = 1024
+	defaultThreads = 1
+	maxThreads     = 64
+	defaultSkill   = 10
+	maxSkill       = 20
+	maxMultiPV     = 256
+)
+
+// Engine reads UCI commands and answers them on its output
+type Engine struct {
+	out io.Writer
+	mu  sync.Mutex // serializes writes from the command loop and the search
+
+	game   *chess.Game
+	search *search                   // the running search, if any
+	table  *chess.TranspositionTable // kept between searches, created on first use
+
+	hash    int // transposition table size in MB
+	threads int
+	skill   int // search depth when "go" sets no limit
+	multiPV int // lines to report
+	options chess.SearchOptions
+}
+
+// search tracks a search running in the background
+type search struct {
+	cancel context.CancelFunc // stops the search
+	done   chan struct{}      // closed once the best move has been sent
+}
+
+// NewEngine creates an engine that writes its replies to out
+func NewEngine(out io.Writer) *Engine {
+	return &Engine{
+		out:     out,
+		game:    chess.NewGame(),
+		hash:    defaultHash,
+		threads: defaultThreads,
+		skill:   defaultSkill,
+		multiPV: 1,
+		options: chess.DefaultSearchOptions(),
+	}
+}
+
+// Run processes commands from in until "quit" or the end of the input. A
+// running search is stopped, and its best move sent, before Run returns.
+func (e *Engine) Run(in io.Reader) error {
+	defer e.stopSearch()
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" {
+			return nil
+		}
+		e.handle(fields[0], fields[1:])
+	}
+	return scanner.Err()
+}
+
+// handle runs one command. Unknown commands are reported in an info string
+// and otherwise ignored, as the protocol asks.
+func (e *Engine) handle(command string, args []string) {
+	switch command {
+	case "uci":
+		e.send("id name %s", engineName)
+		e.send("id author %s", engineAuthor)
+		e.send("option name Hash type spin default %d min 1 max %d", defaultHash, maxHash)
+		e.send("option name Threads type spin default %d min 1 max %d", defaultThreads, maxThreads)
+		e.send("option name Skill type spin default %d min 1 max %d", defaultSkill, maxSkill)
+		e.send("option name MultiPV type spin default 1 min 1 max %d", maxMultiPV)
+		for _, option := range e.searchOptions() {
+			e.send("option name %s type check default %t", option.name, *option.value)
+		}
+		e.send("uciok")
+	case "isready":
+		e.send("readyok")
+	case "ucinewgame":
+		e.stopSearch()
+		e.game = chess.NewGame()
+		if e.table != nil {
+			e.table.Clear()
+		}
+	case "setoption":
+		e.setOption(args)
+	case "position":
+		e.stopSearch()
+		e.setPosition(args)
+	case "go":
+		e.stopSearch()
+		e.startSearch(args)
+	case "stop":
+		e.stopSearch()
+	case "debug", "register", "ponderhit":
+		// Accepted but without effect
+	default:
+		e.send("info string unknown command %s", command)
+	}
+}
+
+// send writes one line of output
+func (e *Engine) send(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// searchOption is a switch of the selective search exposed as a check option
+type searchOption struct {
+	name  string
+	value *bool
+}
+
+// searchOptions returns the check options that turn the techniques of the
+// selective search on and off, for measuring what each is worth
+func (e *Engine) searchOptions() []searchOption {
+	return []searchOption{
+		{"NullMove", &e.options.NullMove},
+		{"LateMoveReductions", &e.options.LateMoveReductions},
+		{"Futility", &e.options.Futility},
+		{"ReverseFutility", &e.options.ReverseFutility},
+		{"CheckExtensions", &e.options.CheckExtensions},
+	}
+}
+
+// setOption handles "setoption name <name> [value <value>]"
+func (e *Engine) setOption(args []string) {
+	name, value := parseOption(args)
+
+	for _, option := range e.searchOptions() {
+		if strings.EqualFold(name, option.name) {
+			switch value {
+			case "true":
+				*option.value = true
+			case "false":
+				*option.value = false
+			default:
+				e.send("info string invalid value %q for option %s", value, name)
+			}
+			return
+		}
+	}
+
+	target, limit := (*int)(nil), 0
+	switch strings.ToLower(name) {
+	case "hash":
+		target, limit = &e.hash, maxHash
+	case "threads":
+		target, limit = &e.threads, maxThreads
+	case "skill":
+		target, limit = &e.skill, maxSkill
+	case "multipv":
+		target, limit = &e.multiPV, maxMultiPV
+	default:
+		e.send("info string unknown option %s", name)
+		return
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > limit {
+		e.send("info string invalid value %q for option %s", value, name)
+		return
+	}
+	*target = n
+	if target == &e.hash {
+		// The next search creates a table of the new size
+		e.table = nil
+	}
+}
+
+// parseOption splits the arguments of setoption into the option name and
+// value, both of which may contain spaces
+func parseOption(args []string) (name, value string) {
+	var nameWords, valueWords []string
+	words := &nameWords
+	for _, arg := range args {
+		switch arg {
+		case "name":
+			words = &nameWords
+		case "value":
+			words = &valueWords
+		default:
+			*words = append(*words, arg)
+		}
+	}
+	return strings.Join(nameWords, " "), strings.Join(valueWords, " ")
+}
+
+// setPosition handles "position startpos|fen <fen> [moves <move>...]"
+func (e *Engine) setPosition(args []string) {
+	if len(args) == 0 {
+		e.send("info string position needs startpos or fen")
+		return
+	}
+
+	moves := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			moves = i
+			break
+		}
+	}
+
+	var game *chess.Game
+	switch args[0] {
+	case "startpos":
+		game = chess.NewGame()
+	case "fen":
+		var err error
+		if game, err = chess.ParseFEN(strings.Join(args[1:moves], " ")); err != nil {
+			e.send("info string invalid position: %v", err)
+			return
+		}
+	default:
+		e.send("info string position needs startpos or fen")
+		return
+	}
+
+	if moves < len(args) {
+		for _, text := range args[moves+1:] {
+			move, err := chess.ParseMove(text)
+			if err == nil {
+				err = game.ApplyMove(move)
+			}
+			if err != nil {
+				e.send("info string illegal move %s: %v", text, err)
+				return
+			}
+		}
+	}
+
+	e.game = game
+}
+
+// parseGo reads the parameters of a "go" command into search limits for the
+// player to move, and reports whether the search is infinite. Unknown or
+// malformed parameters are skipped.
+func parseGo(args []string, player chess.Color) (chess.Limits, bool) {
+	var limits chess.Limits
+	infinite := false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			infinite = true
+			continue
+		}
+		if i+1 >= len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "depth":
+			limits.Depth = n
+		case "nodes":
+			limits.Nodes = uint64(n)
+		case "movetime":
+			limits.MoveTime = ms
+		case "wtime", "btime":
+			if (args[i] == "wtime") == (player == chess.White) {
+				limits.Time = ms
+			}
+		case "winc", "binc":
+			if (args[i] == "winc") == (player == chess.White) {
+				limits.Increment = ms
+			}
+		case "movestogo":
+			limits.MovesToGo = n
+		default:
+			continue
+		}
+		i++
+	}
+	return limits, infinite
+}
+
+// startSearch handles "go", searching in the background until a limit is
+// reached or "stop" arrives
+func (e *Engine) startSearch(args []string) {
+	game := e.game
+	limits, infinite := parseGo(args, game.CurrentPlayer)
+	if limits == (chess.Limits{}) && !infinite {
+		limits.Depth = e.skill
+	}
+
+	// The AI's scores are relative to its color, so each search gets its own
+	if e.table == nil {
+		e.table = chess.NewTranspositionTable(e.hash)
+	}
+	table := e.table
+
+	ai := chess.NewAI(game.CurrentPlayer, e.skill)
+	ai.SetOptions(e.options)
+	ai.SetThreads(e.threads)
+	ai.SetTranspositionTable(table)
+	ai.SetMultiPV(e.multiPV)
+	multiPV := e.multiPV > 1
+	ai.OnIteration(func(info chess.SearchResult) {
+		e.sendInfo(info, table.Hashfull(), multiPV)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &search{cancel: cancel, done: make(chan struct{})}
+	e.search = s
+
+	go func() {
+		defer close(s.done)
+		result, ok := ai.Search(ctx, game, limits)
+		// An infinite search reports its move only when told to stop
+		if infinite {
+			<-ctx.Done()
+		}
+		if !ok {
+			e.send("bestmove 0000")
+			return
+		}
+		e.send("bestmove %s", result.Move)
+	}()
+}
+
+// stopSearch stops the running search, if any, and waits for its best move
+func (e *Engine) stopSearch() {
+	if e.search == nil {
+		return
+	}
+	e.search.cancel()
+	<-e.search.done
+	e.search = nil
+}
+
+// sendInfo reports a completed search iteration and how full the
+// transposition table is, in permille. With multiPV each of the ranked
+// lines is reported on its own line, numbered from 1 for the best.
+func (e *Engine) sendInfo(info chess.SearchResult, hashfull int, multiPV bool) {
+	nps := uint64(0)
+	if seconds := info.Time.Seconds(); seconds > 0 {
+		nps = uint64(float64(info.Nodes) / seconds)
+	}
+
+	for i, line := range info.Lines {
+		rank := ""
+		if multiPV {
+			rank = fmt.Sprintf(" multipv %d", i+1)
+		}
+		e.send("info depth %d%s score %s nodes %d nps %d hashfull %d time %d pv %s",
+			info.Depth, rank, formatScore(line.Score), info.Nodes, nps, hashfull, info.Time.Milliseconds(), formatPV(line.PV))
+	}
+}
+
+// formatScore returns the score of a line as "cp <centipawns>" or, for a
+// forced mate, "mate <moves>", negative when the engine is being mated
+func formatScore(score float64) string {
+	if moves, ok := (chess.Line{Score: score}).MateIn(); ok {
+		return fmt.Sprintf("mate %d", moves)
+	}
+	return fmt.Sprintf("cp %d", int(math.Round(score*100)))
+}
+
+// formatPV returns the moves of a principal variation separated by spaces
+func formatPV(pv []chess.Move) string {
+	moves := make([]string, len(pv))
+	for i, move := range pv {
+		moves[i] = move.String()
+	}
+	return strings.Join(moves, " ")
+}
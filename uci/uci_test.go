@@ -0,0 +1,322 @@
+package uci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"chess-game/chess"
+)
+
+// session runs an engine connected to the test through in-memory pipes
+type session struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	lines  chan string
+	done   chan error
+	engine *Engine
+}
+
+// startEngine runs a new engine in the background
+func startEngine(t *testing.T) *session {
+	t.Helper()
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	s := &session{t: t, in: inWriter, lines: make(chan string, 1000), done: make(chan error, 1)}
+	s.engine = NewEngine(outWriter)
+	go func() {
+		s.done <- s.engine.Run(inReader)
+		outWriter.Close()
+	}()
+	// Read the output as it comes so the engine never blocks writing it
+	go func() {
+		scanner := bufio.NewScanner(outReader)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+		close(s.lines)
+	}()
+
+	t.Cleanup(s.quit)
+	return s
+}
+
+// send writes commands to the engine
+func (s *session) send(commands ...string) {
+	for _, command := range commands {
+		fmt.Fprintln(s.in, command)
+	}
+}
+
+// expect reads output up to and including the first line starting with prefix
+func (s *session) expect(prefix string) []string {
+	s.t.Helper()
+	var lines []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.t.Fatalf("Engine stopped before sending %q; got %q", prefix, lines)
+			}
+			lines = append(lines, line)
+			if strings.HasPrefix(line, prefix) {
+				return lines
+			}
+		case <-timeout:
+			s.t.Fatalf("Timed out waiting for %q; got %q", prefix, lines)
+		}
+	}
+}
+
+// quit closes the engine's input and waits for it to finish
+func (s *session) quit() {
+	s.in.Close()
+	for range s.lines {
+	}
+	if err := <-s.done; err != nil {
+		s.t.Errorf("Run returned error: %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	s := startEngine(t)
+	s.send("uci")
+	lines := s.expect("uciok")
+
+	output := strings.Join(lines, "\n")
+	for _, want := range []string{"id name", "id author", "option name Hash", "option name Threads", "option name Skill",
+		"option name MultiPV type spin default 1",
+		"option name NullMove type check default true", "option name CheckExtensions type check default true"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("uci reply should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	s.send("isready")
+	s.expect("readyok")
+}
+
+func TestGoDepth(t *testing.T) {
+	s := startEngine(t)
+	s.send("position startpos moves e2e4 e7e5", "go depth 2")
+	lines := s.expect("bestmove")
+
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "info depth 1 ") || !strings.HasPrefix(lines[1], "info depth 2 ") {
+		t.Fatalf("Expected an info line per depth before the best move, got %q", lines)
+	}
+	for _, field := range []string{" score cp ", " nodes ", " nps ", " hashfull ", " pv "} {
+		if !strings.Contains(lines[1], field) {
+			t.Errorf("Info line should contain %q, got %q", field, lines[1])
+		}
+	}
+	if _, pv, _ := strings.Cut(lines[1], " pv "); len(strings.Fields(pv)) != 2 {
+		t.Errorf("Expected a two move principal variation at depth 2, got %q", lines[1])
+	}
+
+	// The best move must be legal for White in the position
+	game := chess.NewGame()
+	game.MakeMove("e2", "e4")
+	game.MakeMove("e7", "e5")
+	move, err := chess.ParseMove(strings.TrimPrefix(lines[2], "bestmove "))
+	if err != nil || !game.IsLegal(move) {
+		t.Errorf("Expected a legal best move, got %q", lines[2])
+	}
+}
+
+func TestMateScore(t *testing.T) {
+	s := startEngine(t)
+	s.send("position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "go depth 2")
+	lines := s.expect("bestmove")
+
+	if got := lines[len(lines)-1]; got != "bestmove a1a8" {
+		t.Errorf("Expected the mating move, got %q", got)
+	}
+	if !strings.Contains(lines[0], "score mate 1 ") {
+		t.Errorf("Expected a mate in one score, got %q", lines[0])
+	}
+}
+
+func TestNoLegalMoves(t *testing.T) {
+	s := startEngine(t)
+	s.send("position fen 6Rk/5Q2/8/8/8/8/8/6K1 b - - 0 1", "go depth 2")
+	if lines := s.expect("bestmove"); lines[len(lines)-1] != "bestmove 0000" {
+		t.Errorf("Expected a null move when mated, got %q", lines)
+	}
+}
+
+func TestGoInfiniteWaitsForStop(t *testing.T) {
+	s := startEngine(t)
+	s.send("position startpos", "go infinite")
+	s.expect("info depth 1 ")
+
+	select {
+	case line := <-s.lines:
+		if strings.HasPrefix(line, "bestmove") {
+			t.Fatalf("An infinite search should not send its move before stop, got %q", line)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.send("stop")
+	s.expect("bestmove")
+}
+
+func TestGoMoveTime(t *testing.T) {
+	s := startEngine(t)
+	start := time.Now()
+	s.send("position startpos", "go movetime 200")
+	s.expect("bestmove")
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Search with movetime 200 took %v", elapsed)
+	}
+}
+
+func TestGoClock(t *testing.T) {
+	s := startEngine(t)
+	s.send("position startpos moves e2e4", "go wtime 1000 btime 3000 winc 0 binc 0")
+	s.expect("bestmove")
+}
+
+func TestSetOption(t *testing.T) {
+	s := startEngine(t)
+	s.send("setoption name Skill value 1", "go")
+	if lines := s.expect("bestmove"); len(lines) != 2 || !strings.HasPrefix(lines[0], "info depth 1 ") {
+		t.Errorf("Skill 1 should search one ply, got %q", lines)
+	}
+
+	s.send("setoption name Hash value 64", "setoption name Threads value 2", "isready")
+	if lines := s.expect("readyok"); len(lines) != 1 {
+		t.Errorf("Valid options should be set silently, got %q", lines)
+	}
+
+	s.send("setoption name Skill value 99")
+	s.expect("info string invalid value")
+	s.send("setoption name NullMove value maybe")
+	s.expect("info string invalid value")
+	s.send("setoption name Ponder value true")
+	s.expect("info string unknown option Ponder")
+}
+
+func TestMultiPV(t *testing.T) {
+	s := startEngine(t)
+	s.send("setoption name MultiPV value 3", "position startpos", "go depth 2")
+	lines := s.expect("bestmove")
+
+	// Each depth reports the three best lines, ranked
+	if len(lines) != 7 {
+		t.Fatalf("Expected three info lines per depth and the best move, got %q", lines)
+	}
+	for i, line := range lines[:6] {
+		prefix := fmt.Sprintf("info depth %d multipv %d score ", i/3+1, i%3+1)
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("Expected %q to start with %q", line, prefix)
+		}
+	}
+	_, best, _ := strings.Cut(lines[3], " pv ")
+	if !strings.HasPrefix(lines[6], "bestmove "+strings.Fields(best)[0]) {
+		t.Errorf("The best move should start the first line, got %q and %q", lines[3], lines[6])
+	}
+}
+
+func TestHashOption(t *testing.T) {
+	s := startEngine(t)
+	s.send("go depth 2")
+	s.expect("bestmove")
+	table := s.engine.table
+
+	// The table is kept between searches until Hash changes
+	s.send("go depth 2")
+	s.expect("bestmove")
+	if s.engine.table != table {
+		t.Error("The table should be kept between searches")
+	}
+	s.send("setoption name Hash value 2", "go depth 2")
+	s.expect("bestmove")
+	if s.engine.table == table {
+		t.Error("Changing Hash should create a new table")
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	e := NewEngine(io.Discard)
+	e.handle("setoption", strings.Fields("name NullMove value false"))
+	e.handle("setoption", strings.Fields("name futility value false"))
+
+	want := chess.DefaultSearchOptions()
+	want.NullMove, want.Futility = false, false
+	if e.options != want {
+		t.Errorf("Expected options %+v, got %+v", want, e.options)
+	}
+}
+
+func TestInvalidPosition(t *testing.T) {
+	s := startEngine(t)
+	s.send("position startpos moves e2e5")
+	s.expect("info string illegal move e2e5")
+	s.send("position fen not a fen")
+	s.expect("info string invalid position")
+}
+
+func TestParseGo(t *testing.T) {
+	args := strings.Fields("wtime 60000 btime 30000 winc 1000 binc 500 movestogo 20 depth 6 nodes 5000")
+
+	limits, infinite := parseGo(args, chess.Black)
+	want := chess.Limits{Depth: 6, Nodes: 5000, Time: 30 * time.Second, Increment: 500 * time.Millisecond, MovesToGo: 20}
+	if limits != want || infinite {
+		t.Errorf("Expected %+v for Black, got %+v (infinite %v)", want, limits, infinite)
+	}
+
+	limits, _ = parseGo(args, chess.White)
+	if limits.Time != time.Minute || limits.Increment != time.Second {
+		t.Errorf("Expected White's clock, got %+v", limits)
+	}
+
+	limits, infinite = parseGo(strings.Fields("infinite movetime 250 depth x"), chess.White)
+	if limits != (chess.Limits{MoveTime: 250 * time.Millisecond}) || !infinite {
+		t.Errorf("Unexpected limits %+v (infinite %v)", limits, infinite)
+	}
+}
+
+func TestGoNodes(t *testing.T) {
+	s := startEngine(t)
+	s.send("position startpos", "go nodes 3000")
+	lines := s.expect("bestmove")
+
+	// Only iterations that complete within the limit are reported
+	if len(lines) < 2 {
+		t.Fatalf("Expected at least one completed iteration, got %q", lines)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.Fields(line)
+		for i, field := range fields[:len(fields)-1] {
+			if nodes, err := strconv.Atoi(fields[i+1]); field == "nodes" && (err != nil || nodes > 3000) {
+				t.Errorf("Iteration went past the node limit: %q", line)
+			}
+		}
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{0.5, "cp 50"},
+		{-1.234, "cp -123"},
+		{999, "mate 1"},
+		{997, "mate 2"},
+		{-998, "mate -1"},
+	}
+	for _, tt := range tests {
+		if got := formatScore(tt.score); got != tt.want {
+			t.Errorf("formatScore(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
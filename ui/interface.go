@@ -3,15 +3,27 @@ package ui
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	"chess-game/chess"
 )
 
+// aiDepth is how many plies ahead the computer looks
+const aiDepth = 3
+
+// analysisDepth is how many plies ahead the analyze command looks, and
+// analysisLines how many candidate moves it shows unless told otherwise
+const (
+	analysisDepth = 4
+	analysisLines = 3
+)
+
 // Interface handles the user interface for the chess game
 type Interface struct {
 	game   *chess.Game
@@ -21,13 +33,28 @@ type Interface struct {
 
 // NewInterface creates a new interface
 func NewInterface() *Interface {
+	game := chess.NewGame()
+	game.Tags = map[string]string{
+		"Event": "Casual game",
+		"Site":  "Terminal",
+		"Date":  time.Now().Format("2006.01.02"),
+		"White": "Player",
+		"Black": "Computer",
+	}
+
 	return &Interface{
-		game:   chess.NewGame(),
+		game:   game,
 		reader: bufio.NewReader(os.Stdin),
-		ai:     chess.NewAI(chess.Black, 3), // AI plays as black with depth 3
+		ai:     chess.NewAI(chess.Black, aiDepth), // AI plays as black
 	}
 }
 
+// SetTimeControl plays the game on a clock with the given time control. The
+// clock starts when Run begins.
+func (ui *Interface) SetTimeControl(control chess.TimeControl) {
+	ui.game.Clock = chess.NewClock(control, nil)
+}
+
 // clearScreen clears the terminal screen
 func (ui *Interface) clearScreen() {
 	cmd := exec.Command("clear")
@@ -44,11 +71,21 @@ func (ui *Interface) displayWelcome() {
 	fmt.Println("║                                      ║")
 	fmt.Println("║  Enter moves in algebraic notation   ║")
 	fmt.Println("║  Example: e2 e4 (move from e2 to e4) ║")
+	fmt.Println("║  or in SAN, e.g. Nf3, exd5, O-O      ║")
 	fmt.Println("║                                      ║")
 	fmt.Println("║  Commands:                           ║")
 	fmt.Println("║  - 'quit' or 'exit' to quit          ║")
 	fmt.Println("║  - 'help' for help                   ║")
 	fmt.Println("║  - 'moves <pos>' to see valid moves  ║")
+	fmt.Println("║  - 'save <file>' to save as PGN      ║")
+	fmt.Println("║  - 'undo' / 'redo' to take back or   ║")
+	fmt.Println("║    replay your last move             ║")
+	fmt.Println("║  - 'claim' to claim a draw by the    ║")
+	fmt.Println("║    fifty-move rule or repetition     ║")
+	fmt.Println("║  - 'draw' to offer a draw            ║")
+	fmt.Println("║  - 'resign' to resign the game       ║")
+	fmt.Println("║  - 'analyze [n]' to see the n best   ║")
+	fmt.Println("║    moves, 3 by default               ║")
 	fmt.Println("╚══════════════════════════════════════╝")
 	fmt.Println()
 }
@@ -67,6 +104,11 @@ func (ui *Interface) displayHelp() {
 	fmt.Println("║ Move Format:                         ║")
 	fmt.Println("║ <from> <to>                          ║")
 	fmt.Println("║ Example: e2 e4                       ║")
+	fmt.Println("║ Castle: move the king two squares    ║")
+	fmt.Println("║ Example: e1 g1                       ║")
+	fmt.Println("║ Promote: add q, r, b or n            ║")
+	fmt.Println("║ Example: e7 e8 q                     ║")
+	fmt.Println("║ SAN also works: e4, Nf3, O-O, e8=Q   ║")
 	fmt.Println("║                                      ║")
 	fmt.Println("║ Board Coordinates:                   ║")
 	fmt.Println("║ Files: a-h (left to right)          ║")
@@ -85,6 +127,11 @@ func (ui *Interface) displayBoard() {
 
 // displayGameStatus displays the current game status
 func (ui *Interface) displayGameStatus() {
+	if clock := ui.game.Clock; clock != nil {
+		fmt.Printf("Clock: White %s | Black %s\n",
+			chess.FormatDuration(clock.Remaining(chess.White)),
+			chess.FormatDuration(clock.Remaining(chess.Black)))
+	}
 	fmt.Println(ui.game.GetGameStatus())
 }
 
@@ -114,39 +161,184 @@ func (ui *Interface) showValidMoves(position string) {
 		return
 	}
 
-	moves := ui.game.Board.GetValidMoves(pos)
-	if len(moves) == 0 {
+	// Promotions are listed once per destination square
+	var targets []chess.Position
+	seen := make(map[chess.Position]bool)
+	for _, move := range ui.game.LegalMovesFrom(pos) {
+		if !seen[move.To] {
+			seen[move.To] = true
+			targets = append(targets, move.To)
+		}
+	}
+
+	if len(targets) == 0 {
 		fmt.Printf("No valid moves for piece at %s\n", position)
 		return
 	}
 
 	fmt.Printf("Valid moves for %s %s at %s:\n", piece.Color, piece.Type, position)
-	for i, move := range moves {
-		fmt.Printf("%d. %s", i+1, move.To)
+	for i, target := range targets {
+		fmt.Printf("%d. %s", i+1, target)
 		if (i+1)%8 == 0 {
 			fmt.Println()
 		} else {
 			fmt.Print("  ")
 		}
 	}
-	if len(moves)%8 != 0 {
+	if len(targets)%8 != 0 {
 		fmt.Println()
 	}
 	fmt.Println()
 }
 
+// saveGame writes the game so far to a PGN file
+func (ui *Interface) saveGame(filename string) {
+	if err := os.WriteFile(filename, []byte(ui.game.PGN()), 0o600); err != nil {
+		fmt.Printf("Could not save game: %v\n", err)
+		return
+	}
+	fmt.Printf("Game saved to %s\n", filename)
+}
+
+// undoMove takes back the computer's reply and the player's last move
+func (ui *Interface) undoMove() {
+	if err := ui.game.UndoMove(); err != nil {
+		fmt.Printf("Cannot undo: %v\n", err)
+		return
+	}
+	// Keep undoing until it is the player's turn again
+	if ui.game.CurrentPlayer != chess.White && ui.game.CanUndo() {
+		_ = ui.game.UndoMove() // CanUndo guarantees success
+	}
+	fmt.Println("Move taken back")
+}
+
+// redoMove replays the player's undone move and the computer's reply
+func (ui *Interface) redoMove() {
+	if err := ui.game.RedoMove(); err != nil {
+		fmt.Printf("Cannot redo: %v\n", err)
+		return
+	}
+	// Replay the computer's reply too; if there is none it will move again
+	if ui.game.CurrentPlayer != chess.White && ui.game.CanRedo() {
+		if err := ui.game.RedoMove(); err != nil {
+			fmt.Printf("Cannot redo: %v\n", err)
+			return
+		}
+	}
+	fmt.Println("Move replayed")
+}
+
+// claimDraw ends the game as a draw if the fifty-move rule or threefold repetition applies
+func (ui *Interface) claimDraw() {
+	if err := ui.game.ClaimDraw(); err != nil {
+		fmt.Printf("Cannot claim a draw: %v\n", err)
+		return
+	}
+	fmt.Printf("Draw claimed by %s\n", ui.game.DrawReason)
+}
+
+// offerDraw offers the computer a draw, which it accepts unless it is ahead
+func (ui *Interface) offerDraw() {
+	if err := ui.game.OfferDraw(chess.White); err != nil {
+		fmt.Printf("Cannot offer a draw: %v\n", err)
+		return
+	}
+
+	if ui.ai.AcceptsDraw(ui.game) {
+		_ = ui.game.AcceptDraw(chess.Black) // The offer was just made
+		fmt.Println("Computer accepts the draw offer")
+		return
+	}
+
+	_ = ui.game.DeclineDraw() // The offer was just made
+	fmt.Println("Computer declines the draw offer")
+}
+
+// resign gives up the game on the player's behalf
+func (ui *Interface) resign() {
+	if err := ui.game.Resign(chess.White); err != nil {
+		fmt.Printf("Cannot resign: %v\n", err)
+		return
+	}
+	fmt.Println("You resign")
+}
+
+// analyze shows the best moves for the player to move, each with its score
+// from that player's point of view and the line of play it expects
+func (ui *Interface) analyze(args string) {
+	lines := analysisLines
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			fmt.Printf("Invalid number of moves: %s\n", args)
+			return
+		}
+		lines = n
+	}
+
+	ai := chess.NewAI(ui.game.CurrentPlayer, analysisDepth)
+	ai.SetMultiPV(lines)
+	result, ok := ai.Search(context.Background(), ui.game, chess.Limits{Depth: analysisDepth})
+	if !ok {
+		fmt.Println("No moves to analyze")
+		return
+	}
+
+	fmt.Printf("Best moves for %s (depth %d):\n", ui.game.CurrentPlayer, result.Depth)
+	for i, line := range result.Lines {
+		fmt.Printf("%2d. %-12s %s\n", i+1, formatScore(line), strings.Join(ui.game.SANLine(line.PV), " "))
+	}
+}
+
+// formatScore returns the score of a line in pawns, such as "+0.35", or the
+// moves to a forced mate
+func formatScore(line chess.Line) string {
+	if moves, ok := line.MateIn(); ok {
+		if moves < 0 {
+			return fmt.Sprintf("mated in %d", -moves)
+		}
+		return fmt.Sprintf("mate in %d", moves)
+	}
+	return fmt.Sprintf("%+.2f", line.Score)
+}
+
 // processMove processes a move input
 func (ui *Interface) processMove(input string) bool {
 	parts := strings.Fields(input)
-	if len(parts) != 2 {
-		fmt.Println("Invalid move format. Use: <from> <to> (e.g., e2 e4)")
+
+	// A single word is a move in Standard Algebraic Notation
+	if len(parts) == 1 {
+		move, err := ui.game.ParseSAN(parts[0])
+		if err == nil {
+			err = ui.game.ApplyMove(move)
+		}
+		if err != nil {
+			fmt.Printf("Invalid move: %v\n", err)
+			return false
+		}
+		return true
+	}
+
+	if len(parts) != 2 && len(parts) != 3 {
+		fmt.Println("Invalid move format. Use: <from> <to> [q|r|b|n] or SAN (e.g., e2 e4, e7 e8 q or Nf3)")
 		return false
 	}
 
 	from := parts[0]
 	to := parts[1]
 
-	err := ui.game.MakeMove(from, to)
+	promotion := chess.NoPromotion
+	if len(parts) == 3 {
+		var err error
+		promotion, err = chess.ParsePromotion(parts[2])
+		if err != nil {
+			fmt.Printf("Invalid move: %v\n", err)
+			return false
+		}
+	}
+
+	err := ui.game.MakeMoveWithPromotion(from, to, promotion)
 	if err != nil {
 		fmt.Printf("Invalid move: %v\n", err)
 		return false
@@ -163,22 +355,28 @@ func (ui *Interface) makeAIMove() bool {
 
 	fmt.Println("Computer is thinking...")
 
-	// Add a small delay to make it feel more natural
-	time.Sleep(1 * time.Second)
+	// On a clock the computer also budgets its time, stopping short of aiDepth if needed
+	limits := chess.Limits{Depth: aiDepth}
+	if ui.game.Clock != nil {
+		limits = ui.game.Clock.Limits(chess.Black)
+		limits.Depth = aiDepth
+	}
 
-	from, to, ok := ui.ai.GetBestMove(ui.game)
+	result, ok := ui.ai.Search(context.Background(), ui.game, limits)
 	if !ok {
 		fmt.Println("Computer has no valid moves!")
 		return false
 	}
 
-	err := ui.game.MakeMove(from.String(), to.String())
+	move := result.Move
+	san := ui.game.SAN(move)
+	err := ui.game.ApplyMove(move)
 	if err != nil {
 		fmt.Printf("Computer move error: %v\n", err)
 		return false
 	}
 
-	fmt.Printf("Computer plays: %s -> %s\n", from.String(), to.String())
+	fmt.Printf("Computer plays: %s (%s -> %s)\n", san, move.From, move.To)
 	return true
 }
 
@@ -187,6 +385,10 @@ func (ui *Interface) Run() {
 	ui.clearScreen()
 	ui.displayWelcome()
 
+	if ui.game.Clock != nil {
+		ui.game.Clock.Start(ui.game.CurrentPlayer)
+	}
+
 	for !ui.game.IsGameOver() {
 		ui.displayBoard()
 		ui.displayGameStatus()
@@ -202,6 +404,9 @@ func (ui *Interface) Run() {
 
 		// Human player's turn
 		input := ui.getInput()
+		if ui.game.CheckTime() {
+			break
+		}
 
 		// Handle commands
 		switch {
@@ -215,6 +420,27 @@ func (ui *Interface) Run() {
 			position := strings.TrimPrefix(input, "moves ")
 			ui.showValidMoves(position)
 			continue
+		case input == "undo":
+			ui.undoMove()
+			continue
+		case input == "redo":
+			ui.redoMove()
+			continue
+		case input == "claim":
+			ui.claimDraw()
+			continue
+		case input == "draw":
+			ui.offerDraw()
+			continue
+		case input == "resign":
+			ui.resign()
+			continue
+		case input == "analyze" || strings.HasPrefix(input, "analyze "):
+			ui.analyze(strings.TrimSpace(strings.TrimPrefix(input, "analyze")))
+			continue
+		case strings.HasPrefix(input, "save "):
+			ui.saveGame(strings.TrimSpace(strings.TrimPrefix(input, "save ")))
+			continue
 		case input == "":
 			continue
 		}
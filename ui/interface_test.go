@@ -6,8 +6,10 @@ import (
 	"chess-game/chess"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewInterface(t *testing.T) {
@@ -259,9 +261,9 @@ func TestShowValidMovesNoMoves(t *testing.T) {
 	io.Copy(&buf, r)
 	output := buf.String()
 
-	// The king should show basic valid moves (even though they would be illegal due to check)
-	if !strings.Contains(output, "Valid moves for White King at d5") {
-		t.Errorf("Should show valid moves for king, got: %s", output)
+	// Every square around the king is attacked, so it has no legal moves
+	if !strings.Contains(output, "No valid moves for piece at d5") {
+		t.Errorf("Should show no legal moves for king, got: %s", output)
 	}
 }
 
@@ -289,7 +291,7 @@ func TestProcessMoveInvalidFormat(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	success := ui.processMove("e2")
+	success := ui.processMove("e2 e4 e5 e6")
 
 	w.Close()
 	os.Stdout = old
@@ -569,3 +571,286 @@ func TestRunGameOver(t *testing.T) {
 		t.Error("Should show game over message")
 	}
 }
+
+func TestProcessMovePromotion(t *testing.T) {
+	ui := NewInterface()
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			ui.game.Board.SetPiece(chess.NewPosition(i, j), nil)
+		}
+	}
+	ui.game.Board.SetPiece(chess.NewPosition(7, 0), chess.NewPiece(chess.King, chess.White)) // a1
+	ui.game.Board.SetPiece(chess.NewPosition(0, 0), chess.NewPiece(chess.King, chess.Black)) // a8
+	ui.game.Board.SetPiece(chess.NewPosition(1, 4), chess.NewPiece(chess.Pawn, chess.White)) // e7
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	missing := ui.processMove("e7 e8")
+	invalid := ui.processMove("e7 e8 k")
+	success := ui.processMove("e7 e8 n")
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if missing || invalid {
+		t.Error("Promotion without a valid piece should be rejected")
+	}
+	if !strings.Contains(output, "promotion piece required") {
+		t.Errorf("Should explain that a promotion piece is required, got: %s", output)
+	}
+	if !success {
+		t.Error("Promotion with a piece choice should succeed")
+	}
+
+	piece := ui.game.Board.GetPiece(chess.NewPosition(0, 4)) // e8
+	if piece == nil || piece.Type != chess.Knight {
+		t.Error("Pawn should have promoted to a knight on e8")
+	}
+}
+
+func TestSaveGame(t *testing.T) {
+	ui := NewInterface()
+	ui.processMove("e2 e4")
+
+	filename := filepath.Join(t.TempDir(), "game.pgn")
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	ui.saveGame(filename)
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Game saved") {
+		t.Errorf("Should confirm the save, got: %s", output)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Saved file should exist: %v", err)
+	}
+	pgn := string(data)
+	if !strings.Contains(pgn, `[White "Player"]`) || !strings.Contains(pgn, "1. e4 *") {
+		t.Errorf("Saved PGN should contain tags and moves, got:\n%s", pgn)
+	}
+}
+
+func TestProcessMoveSAN(t *testing.T) {
+	ui := NewInterface()
+
+	if !ui.processMove("Nf3") {
+		t.Fatal("Valid SAN move should return true")
+	}
+	piece := ui.game.Board.GetPiece(chess.NewPosition(5, 5)) // f3
+	if piece == nil || piece.Type != chess.Knight {
+		t.Error("Knight should have moved to f3")
+	}
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	success := ui.processMove("Qh5")
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if success {
+		t.Error("Illegal SAN move should return false")
+	}
+	if !strings.Contains(output, "Invalid move") {
+		t.Error("Should show invalid move error")
+	}
+}
+
+func TestUndoRedoCommands(t *testing.T) {
+	ui := NewInterface()
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	ui.undoMove()
+	ui.processMove("e2 e4")
+	ui.processMove("e7 e5") // Stands in for the computer's reply
+	ui.undoMove()
+	undoneLength := len(ui.game.MoveHistory)
+	undonePlayer := ui.game.CurrentPlayer
+	ui.redoMove()
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Cannot undo") {
+		t.Error("Undo without moves should report an error")
+	}
+	if undoneLength != 0 || undonePlayer != chess.White {
+		t.Errorf("Undo should take back both moves, got %d moves with %s to play", undoneLength, undonePlayer)
+	}
+	if len(ui.game.MoveHistory) != 2 || ui.game.CurrentPlayer != chess.White {
+		t.Errorf("Redo should replay both moves, got %d moves", len(ui.game.MoveHistory))
+	}
+	if !strings.Contains(output, "Move replayed") {
+		t.Error("Redo should confirm the replay")
+	}
+}
+
+func TestClaimDrawCommand(t *testing.T) {
+	ui := NewInterface()
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	ui.claimDraw()
+	for i := 0; i < 2; i++ {
+		for _, move := range []string{"Nf3", "Nf6", "Ng1", "Ng8"} {
+			ui.processMove(move)
+		}
+	}
+	ui.claimDraw()
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Cannot claim a draw") {
+		t.Error("Claiming without grounds should report an error")
+	}
+	if !strings.Contains(output, "Draw claimed by threefold repetition") {
+		t.Errorf("Expected a successful claim, got %q", output)
+	}
+	if !ui.game.IsGameOver() {
+		t.Error("A claimed draw should end the game")
+	}
+}
+
+func TestResignAndDrawCommands(t *testing.T) {
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	// Material is level, so the computer accepts
+	drawn := NewInterface()
+	drawn.offerDraw()
+
+	// A queen down, the computer is ahead and declines
+	declined := NewInterface()
+	declined.game.Board.SetPiece(chess.NewPosition(7, 3), nil)
+	declined.offerDraw()
+	declined.resign()
+	declined.resign()
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Computer accepts the draw offer") || drawn.game.Termination() != chess.ByAgreement {
+		t.Errorf("Computer should accept a draw in a level position, got %q", output)
+	}
+	if !strings.Contains(output, "Computer declines the draw offer") {
+		t.Errorf("Computer should decline a draw when ahead, got %q", output)
+	}
+	if declined.game.Result() != chess.BlackWins || declined.game.Termination() != chess.ByResignation {
+		t.Errorf("Expected 0-1 by resignation, got %s by %s", declined.game.Result(), declined.game.Termination())
+	}
+	if !strings.Contains(output, "Cannot resign") {
+		t.Error("Resigning twice should report an error")
+	}
+}
+
+func TestAnalyzeCommand(t *testing.T) {
+	ui := NewInterface()
+	game, err := chess.ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if err != nil {
+		t.Fatalf("ParseFEN failed: %v", err)
+	}
+	ui.game = game
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	ui.analyze("2")
+	ui.analyze("none")
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, " 1. mate in 1") || !strings.Contains(output, "Ra8#") {
+		t.Errorf("The mate in one should be the best line, got %q", output)
+	}
+	if !strings.Contains(output, " 2. ") || strings.Contains(output, " 3. ") {
+		t.Errorf("Expected exactly two lines, got %q", output)
+	}
+	if !strings.Contains(output, "Invalid number of moves: none") {
+		t.Errorf("An invalid count should be reported, got %q", output)
+	}
+	if len(ui.game.MoveHistory) != 0 {
+		t.Error("Analysis should not change the game")
+	}
+}
+
+func TestSetTimeControl(t *testing.T) {
+	ui := NewInterface()
+	ui.SetTimeControl(chess.Fischer(5*time.Minute, 3*time.Second))
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	ui.displayGameStatus()
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Clock: White 5:00 | Black 5:00") {
+		t.Errorf("Status should show both clocks, got %q", output)
+	}
+	if _, running := ui.game.Clock.Running(); running {
+		t.Error("The clock should not run before the game starts")
+	}
+}
@@ -0,0 +1,393 @@
+// Package xboard implements the Chess Engine Communication Protocol (version
+// 2) used by XBoard, WinBoard and older tooling to talk to engines.
+package xboard
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chess-game/chess"
+)
+
+// engineName is announced in the feature reply to "protover"
+const engineName = "chess-game"
+
+// Engine reads CECP commands and answers them on its output
+type Engine struct {
+	out io.Writer
+	mu  sync.Mutex // serializes writes from the command loop and the search
+
+	game   *chess.Game
+	search *search                   // the running search, if any
+	table  *chess.TranspositionTable // kept between searches, created on first use
+
+	force       bool        // only check and record moves, never think
+	engineColor chess.Color // the side the engine plays when not in force mode
+	post        bool        // send thinking output
+	cores       int         // search threads from "cores"
+	memory      int         // transposition table size in MB from "memory"
+
+	depth     int           // search depth limit from "sd", 0 for none
+	moveTime  time.Duration // fixed time per move from "st", 0 for none
+	movesPer  int           // moves per time control period from "level", 0 for all
+	increment time.Duration
+	clock     time.Duration // the engine's remaining time from "level" and "time"
+}
+
+// search tracks a search running in the background
+type search struct {
+	cancel  context.CancelFunc // stops the search
+	aborted atomic.Bool        // set when the move found should not be played
+	done    chan struct{}      // closed once the search has finished
+}
+
+// NewEngine creates an engine that writes its replies to out
+func NewEngine(out io.Writer) *Engine {
+	e := &Engine{out: out, cores: 1, memory: chess.DefaultHashSize}
+	e.newGame()
+	return e
+}
+
+// newGame sets up a new game with the engine playing Black on the default
+// time control of 40 moves in 5 minutes
+func (e *Engine) newGame() {
+	e.game = chess.NewGame()
+	if e.table != nil {
+		e.table.Clear()
+	}
+	e.force = false
+	e.engineColor = chess.Black
+	e.depth = 0
+	e.moveTime = 0
+	e.movesPer = 40
+	e.increment = 0
+	e.clock = 5 * time.Minute
+}
+
+// Run processes commands from in until "quit" or the end of the input. A
+// running search is abandoned before Run returns.
+func (e *Engine) Run(in io.Reader) error {
+	defer e.stopSearch(true)
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" {
+			return nil
+		}
+		e.handle(fields[0], fields[1:])
+	}
+	return scanner.Err()
+}
+
+// handle runs one command
+func (e *Engine) handle(command string, args []string) {
+	switch command {
+	case "protover":
+		e.send("feature myname=\"%s\" usermove=1 setboard=1 ping=1 colors=0 sigint=0 sigterm=0 analyze=0 smp=1 memory=1 done=1", engineName)
+	case "new":
+		e.stopSearch(true)
+		e.newGame()
+	case "force":
+		e.stopSearch(true)
+		e.force = true
+	case "go":
+		e.stopSearch(true)
+		e.force = false
+		e.engineColor = e.game.CurrentPlayer
+		e.think()
+	case "playother":
+		e.stopSearch(true)
+		e.force = false
+		e.engineColor = e.game.CurrentPlayer.Opponent()
+	case "usermove":
+		if len(args) != 1 {
+			e.send("Error (usermove needs a move): %s", strings.Join(args, " "))
+			return
+		}
+		e.userMove(args[0])
+	case "?":
+		// Move now
+		if e.search != nil {
+			e.search.cancel()
+		}
+	case "ping":
+		// Pong only once every earlier command, including a search, is done
+		e.stopSearch(false)
+		e.send("pong %s", strings.Join(args, " "))
+	case "setboard":
+		e.stopSearch(true)
+		game, err := chess.ParseFEN(strings.Join(args, " "))
+		if err != nil {
+			e.send("tellusererror Illegal position: %v", err)
+			return
+		}
+		e.game = game
+	case "undo":
+		e.stopSearch(true)
+		e.takeBack(1)
+	case "remove":
+		e.stopSearch(true)
+		e.takeBack(2)
+	case "result":
+		e.stopSearch(true)
+		e.force = true
+	case "level":
+		e.setLevel(args)
+	case "st":
+		if seconds, err := strconv.ParseFloat(argument(args), 64); err == nil && seconds > 0 {
+			e.moveTime = time.Duration(seconds * float64(time.Second))
+			return
+		}
+		e.send("Error (bad time): st %s", strings.Join(args, " "))
+	case "sd":
+		if depth, err := strconv.Atoi(argument(args)); err == nil && depth > 0 {
+			e.depth = depth
+			return
+		}
+		e.send("Error (bad depth): sd %s", strings.Join(args, " "))
+	case "time":
+		if centiseconds, err := strconv.Atoi(argument(args)); err == nil {
+			e.clock = time.Duration(centiseconds) * 10 * time.Millisecond
+			return
+		}
+		e.send("Error (bad time): time %s", strings.Join(args, " "))
+	case "cores":
+		if cores, err := strconv.Atoi(argument(args)); err == nil && cores > 0 {
+			e.cores = cores
+			return
+		}
+		e.send("Error (bad number of cores): cores %s", strings.Join(args, " "))
+	case "memory":
+		if memory, err := strconv.Atoi(argument(args)); err == nil && memory > 0 {
+			if memory != e.memory {
+				e.stopSearch(true)
+				e.memory = memory
+				e.table = nil
+			}
+			return
+		}
+		e.send("Error (bad memory size): memory %s", strings.Join(args, " "))
+	case "post":
+		e.post = true
+	case "nopost":
+		e.post = false
+	case "xboard", "accepted", "rejected", "otim", "random", "hard", "easy",
+		"computer", "name", "rating", "ics", "white", "black":
+		// Accepted without effect. The time budget depends only on the
+		// engine's own clock, so the opponent's time from otim is not needed.
+	default:
+		// Protocol version 1 interfaces send bare moves
+		if _, err := chess.ParseMove(command); err == nil && len(args) == 0 {
+			e.userMove(command)
+			return
+		}
+		e.send("Error (unknown command): %s", command)
+	}
+}
+
+// send writes one line of output
+func (e *Engine) send(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// argument returns the single argument of a command, or "" if there is not exactly one
+func argument(args []string) string {
+	if len(args) != 1 {
+		return ""
+	}
+	return args[0]
+}
+
+// userMove plays the opponent's move and, unless in force mode, replies
+func (e *Engine) userMove(text string) {
+	e.stopSearch(true)
+
+	move, err := chess.ParseMove(text)
+	if err == nil {
+		err = e.game.ApplyMove(move)
+	}
+	if err != nil {
+		e.send("Illegal move: %s", text)
+		return
+	}
+
+	if e.sendResult() {
+		return
+	}
+	if !e.force && e.game.CurrentPlayer == e.engineColor {
+		e.think()
+	}
+}
+
+// takeBack undoes the given number of moves
+func (e *Engine) takeBack(moves int) {
+	for i := 0; i < moves; i++ {
+		if err := e.game.UndoMove(); err != nil {
+			e.send("Error (%v): undo", err)
+			return
+		}
+	}
+}
+
+// setLevel handles "level MPS BASE INC", where BASE is minutes or
+// minutes:seconds and INC is seconds
+func (e *Engine) setLevel(args []string) {
+	if len(args) != 3 {
+		e.send("Error (level needs MPS BASE INC): level %s", strings.Join(args, " "))
+		return
+	}
+
+	movesPer, err1 := strconv.Atoi(args[0])
+	base, err2 := parseBase(args[1])
+	increment, err3 := strconv.ParseFloat(args[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || movesPer < 0 || increment < 0 {
+		e.send("Error (bad time control): level %s", strings.Join(args, " "))
+		return
+	}
+
+	e.movesPer = movesPer
+	e.clock = base
+	e.increment = time.Duration(increment * float64(time.Second))
+	e.moveTime = 0
+}
+
+// parseBase parses the base time of a level command: "5" or "0:30"
+func parseBase(s string) (time.Duration, error) {
+	minutes, seconds, found := strings.Cut(s, ":")
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("invalid base time: %s", s)
+	}
+	base := time.Duration(m) * time.Minute
+	if found {
+		sec, err := strconv.Atoi(seconds)
+		if err != nil || sec < 0 || sec >= 60 {
+			return 0, fmt.Errorf("invalid base time: %s", s)
+		}
+		base += time.Duration(sec) * time.Second
+	}
+	return base, nil
+}
+
+// limits returns the search limits for the engine's move: the fixed time per
+// move from st, or else the clock with the moves left in the period
+func (e *Engine) limits() chess.Limits {
+	limits := chess.Limits{Depth: e.depth}
+	if e.moveTime > 0 {
+		limits.MoveTime = e.moveTime
+		return limits
+	}
+
+	limits.Time = e.clock
+	limits.Increment = e.increment
+	if e.movesPer > 0 {
+		limits.MovesToGo = e.movesPer - (e.game.FullmoveNumber-1)%e.movesPer
+	}
+	return limits
+}
+
+// think searches for the engine's move in the background and plays it
+func (e *Engine) think() {
+	game := e.game
+	limits := e.limits()
+
+	if e.table == nil {
+		e.table = chess.NewTranspositionTable(e.memory)
+	}
+
+	ai := chess.NewAI(game.CurrentPlayer, limits.Depth)
+	ai.SetThreads(e.cores)
+	ai.SetTranspositionTable(e.table)
+	if e.post {
+		ai.OnIteration(e.sendThinking)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &search{cancel: cancel, done: make(chan struct{})}
+	e.search = s
+
+	go func() {
+		defer close(s.done)
+		result, ok := ai.Search(ctx, game, limits)
+		cancel()
+		if !ok || s.aborted.Load() {
+			return
+		}
+		if err := game.ApplyMove(result.Move); err != nil {
+			e.send("Error (%v): %s", err, result.Move)
+			return
+		}
+		e.send("move %s", result.Move)
+		e.sendResult()
+	}()
+}
+
+// stopSearch waits for the running search, if any, to finish. With abort it
+// stops the search at once and its move is not played.
+func (e *Engine) stopSearch(abort bool) {
+	if e.search == nil {
+		return
+	}
+	if abort {
+		e.search.aborted.Store(true)
+		e.search.cancel()
+	}
+	<-e.search.done
+	e.search = nil
+}
+
+// sendResult announces the result if the game is over and reports whether it is
+func (e *Engine) sendResult() bool {
+	result := e.game.Result()
+	if result == chess.NoResult {
+		return false
+	}
+
+	var comment string
+	switch termination := e.game.Termination(); termination {
+	case chess.ByCheckmate:
+		comment = e.game.CurrentPlayer.Opponent().String() + " mates"
+	case chess.ByStalemate:
+		comment = "Stalemate"
+	default:
+		comment = "Draw by " + termination.String()
+	}
+	e.send("%s {%s}", result, comment)
+	return true
+}
+
+// sendThinking reports a completed search iteration as "ply score time nodes pv"
+func (e *Engine) sendThinking(info chess.SearchResult) {
+	pv := make([]string, len(info.PV))
+	for i, move := range info.PV {
+		pv[i] = move.String()
+	}
+	e.send("%d %d %d %d %s", info.Depth, formatScore(info), info.Time.Milliseconds()/10, info.Nodes, strings.Join(pv, " "))
+}
+
+// formatScore returns the score of a search iteration in centipawns. Forced
+// mates are reported as 100000 plus the number of moves to mate, negated
+// when the engine is being mated, as XBoard expects.
+func formatScore(info chess.SearchResult) int {
+	if moves, ok := info.MateIn(); ok {
+		if moves < 0 {
+			return -100000 + moves
+		}
+		return 100000 + moves
+	}
+	return int(math.Round(info.Score * 100))
+}
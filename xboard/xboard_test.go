@@ -0,0 +1,387 @@
+package xboard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"chess-game/chess"
+)
+
+// session runs an engine connected to the test through in-memory pipes
+type session struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	lines  chan string
+	done   chan error
+	pings  int
+	engine *Engine
+}
+
+// startEngine runs a new engine in the background
+func startEngine(t *testing.T) *session {
+	t.Helper()
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	s := &session{t: t, in: inWriter, lines: make(chan string, 1000), done: make(chan error, 1)}
+	s.engine = NewEngine(outWriter)
+	go func() {
+		s.done <- s.engine.Run(inReader)
+		outWriter.Close()
+	}()
+	// Read the output as it comes so the engine never blocks writing it
+	go func() {
+		scanner := bufio.NewScanner(outReader)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+		close(s.lines)
+	}()
+
+	t.Cleanup(s.quit)
+	return s
+}
+
+// send writes commands to the engine
+func (s *session) send(commands ...string) {
+	for _, command := range commands {
+		fmt.Fprintln(s.in, command)
+	}
+}
+
+// sync sends a ping and returns the output that came before the pong, which
+// the engine only sends once it has finished with every earlier command
+func (s *session) sync() []string {
+	s.t.Helper()
+	s.pings++
+	pong := fmt.Sprintf("pong %d", s.pings)
+	s.send(fmt.Sprintf("ping %d", s.pings))
+
+	var lines []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.t.Fatalf("Engine stopped before %q; got %q", pong, lines)
+			}
+			if line == pong {
+				return lines
+			}
+			lines = append(lines, line)
+		case <-timeout:
+			s.t.Fatalf("Timed out waiting for %q; got %q", pong, lines)
+		}
+	}
+}
+
+// quit closes the engine's input and waits for it to finish
+func (s *session) quit() {
+	s.in.Close()
+	for range s.lines {
+	}
+	if err := <-s.done; err != nil {
+		s.t.Errorf("Run returned error: %v", err)
+	}
+}
+
+// lastMove returns the move from the last "move" line, failing if there is none
+func lastMove(t *testing.T, lines []string) chess.Move {
+	t.Helper()
+	for i := len(lines) - 1; i >= 0; i-- {
+		if text, ok := strings.CutPrefix(lines[i], "move "); ok {
+			move, err := chess.ParseMove(text)
+			if err != nil {
+				t.Fatalf("Engine sent an unreadable move %q", lines[i])
+			}
+			return move
+		}
+	}
+	t.Fatalf("Expected a move, got %q", lines)
+	return chess.Move{}
+}
+
+func TestProtover(t *testing.T) {
+	s := startEngine(t)
+	s.send("xboard", "protover 2")
+	lines := s.sync()
+
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "feature ") || !strings.HasSuffix(lines[0], "done=1") {
+		t.Fatalf("Expected one feature line ending in done=1, got %q", lines)
+	}
+	for _, feature := range []string{"usermove=1", "setboard=1", "ping=1", "smp=1", "memory=1"} {
+		if !strings.Contains(lines[0], feature) {
+			t.Errorf("Feature line should contain %s, got %q", feature, lines[0])
+		}
+	}
+}
+
+func TestEngineRepliesAsBlack(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "sd 2", "usermove e2e4")
+	lines := s.sync()
+
+	game := chess.NewGame()
+	game.MakeMove("e2", "e4")
+	if move := lastMove(t, lines); !game.IsLegal(move) {
+		t.Errorf("Engine reply %v is not legal for Black", move)
+	}
+}
+
+func TestForceAndGo(t *testing.T) {
+	s := startEngine(t)
+
+	// In force mode moves are only recorded
+	s.send("new", "force", "usermove e2e4", "usermove e7e5")
+	if lines := s.sync(); len(lines) != 0 {
+		t.Fatalf("Engine should not move in force mode, got %q", lines)
+	}
+
+	// go makes the engine play the side to move, here White
+	s.send("sd 2", "go")
+	game := chess.NewGame()
+	game.MakeMove("e2", "e4")
+	game.MakeMove("e7", "e5")
+	move := lastMove(t, s.sync())
+	if !game.IsLegal(move) {
+		t.Fatalf("Engine move %v is not legal for White", move)
+	}
+	game.ApplyMove(move)
+
+	// and it keeps playing White after the opponent replies
+	reply := game.LegalMoves()[0]
+	game.ApplyMove(reply)
+	s.send("usermove " + reply.String())
+	if move := lastMove(t, s.sync()); !game.IsLegal(move) {
+		t.Errorf("Engine move %v is not legal for White", move)
+	}
+}
+
+func TestIllegalMove(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "force", "usermove e2e5", "usermove e2")
+	lines := s.sync()
+
+	want := []string{"Illegal move: e2e5", "Illegal move: e2"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+}
+
+func TestPostThinking(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "post", "sd 2", "usermove e2e4")
+	lines := s.sync()
+
+	if len(lines) != 3 {
+		t.Fatalf("Expected two thinking lines and a move, got %q", lines)
+	}
+	for i, line := range lines[:2] {
+		// The principal variation has a move per ply
+		fields := strings.Fields(line)
+		if len(fields) != 4+i+1 || fields[0] != fmt.Sprint(i+1) {
+			t.Errorf("Expected \"ply score time nodes pv\" for ply %d, got %q", i+1, line)
+		}
+	}
+
+	s.send("nopost", "new", "sd 2", "usermove e2e4")
+	if lines := s.sync(); len(lines) != 1 {
+		t.Errorf("Expected only the move after nopost, got %q", lines)
+	}
+}
+
+func TestUndoAndRemove(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "force", "usermove e2e4", "usermove e7e5", "usermove g1f3", "undo")
+	s.sync()
+	if got := s.engine.game.FEN(); got != "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2" {
+		t.Errorf("undo should take back one move, got %s", got)
+	}
+
+	s.send("remove")
+	s.sync()
+	if got := s.engine.game.FEN(); got != chess.StartFEN {
+		t.Errorf("remove should take back two moves, got %s", got)
+	}
+
+	s.send("undo")
+	if lines := s.sync(); len(lines) != 1 || !strings.HasPrefix(lines[0], "Error") {
+		t.Errorf("Expected an error undoing at the start, got %q", lines)
+	}
+}
+
+func TestEngineAnnouncesMate(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "setboard 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "sd 2", "go")
+	lines := s.sync()
+
+	if len(lines) != 2 || lines[0] != "move a1a8" || lines[1] != "1-0 {White mates}" {
+		t.Errorf("Expected the mating move and the result, got %q", lines)
+	}
+}
+
+func TestUserMoveEndsGame(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "force", "usermove f2f3", "usermove e7e5", "usermove g2g4", "usermove d8h4")
+	lines := s.sync()
+
+	if len(lines) != 1 || lines[0] != "0-1 {Black mates}" {
+		t.Errorf("Expected the result after fool's mate, got %q", lines)
+	}
+}
+
+func TestResultStopsEngine(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "sd 2", "result 1-0 {White resigns}", "usermove e2e4")
+	if lines := s.sync(); len(lines) != 0 {
+		t.Errorf("Engine should not move after a result, got %q", lines)
+	}
+}
+
+func TestMoveNow(t *testing.T) {
+	s := startEngine(t)
+	start := time.Now()
+	s.send("new", "level 0 60 0", "time 360000", "usermove e2e4", "?")
+	lastMove(t, s.sync())
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Engine took %v to move after ?", elapsed)
+	}
+}
+
+func TestCores(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "cores 2", "sd 3", "usermove e2e4")
+	lastMove(t, s.sync())
+	if s.engine.cores != 2 {
+		t.Errorf("Expected 2 cores, got %d", s.engine.cores)
+	}
+
+	s.send("cores 0")
+	if lines := s.sync(); len(lines) != 1 || !strings.HasPrefix(lines[0], "Error") {
+		t.Errorf("Expected an error for 0 cores, got %q", lines)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s := startEngine(t)
+	s.send("new", "sd 2", "usermove e2e4")
+	lastMove(t, s.sync())
+	table := s.engine.table
+
+	s.send("memory 16")
+	s.sync()
+	if s.engine.table != table {
+		t.Error("The table should be kept when its size does not change")
+	}
+	s.send("memory 2")
+	s.sync()
+	if s.engine.table != nil || s.engine.memory != 2 {
+		t.Errorf("A new size should drop the table for a new one, got %d MB", s.engine.memory)
+	}
+
+	s.send("memory x")
+	if lines := s.sync(); len(lines) != 1 || !strings.HasPrefix(lines[0], "Error") {
+		t.Errorf("Expected an error for a bad size, got %q", lines)
+	}
+}
+
+func TestSearchTime(t *testing.T) {
+	s := startEngine(t)
+	start := time.Now()
+	s.send("new", "st 0.2", "usermove e2e4")
+	lastMove(t, s.sync())
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Search with st 0.2 took %v", elapsed)
+	}
+}
+
+func TestTimeControls(t *testing.T) {
+	e := NewEngine(io.Discard)
+
+	// 40 moves in 5 minutes by default
+	if got, want := e.limits(), (chess.Limits{Time: 5 * time.Minute, MovesToGo: 40}); got != want {
+		t.Errorf("Expected default limits %+v, got %+v", want, got)
+	}
+
+	e.handle("level", []string{"40", "2:30", "2"})
+	e.handle("time", []string{"6000"})
+	e.handle("force", nil)
+	for _, move := range []string{"e2e4", "e7e5", "g1f3"} {
+		e.handle("usermove", []string{move})
+	}
+	// Black has played one of its 40 moves
+	if got, want := e.limits(), (chess.Limits{Time: time.Minute, Increment: 2 * time.Second, MovesToGo: 39}); got != want {
+		t.Errorf("Expected limits %+v, got %+v", want, got)
+	}
+
+	e.handle("level", []string{"0", "5", "0"})
+	if got := e.limits(); got.MovesToGo != 0 || got.Time != 5*time.Minute {
+		t.Errorf("A period for the whole game should have no moves to go, got %+v", got)
+	}
+
+	e.handle("st", []string{"5"})
+	e.handle("sd", []string{"4"})
+	if got, want := e.limits(), (chess.Limits{Depth: 4, MoveTime: 5 * time.Second}); got != want {
+		t.Errorf("st and sd should fix the move time and depth, got %+v", got)
+	}
+
+	// new clears the limits
+	e.handle("new", nil)
+	if e.depth != 0 || e.moveTime != 0 {
+		t.Errorf("new should remove sd and st, got depth %d and move time %v", e.depth, e.moveTime)
+	}
+}
+
+func TestParseBase(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"5", 5 * time.Minute},
+		{"0:30", 30 * time.Second},
+		{"2:05", 2*time.Minute + 5*time.Second},
+	}
+	for _, tt := range tests {
+		if got, err := parseBase(tt.input); err != nil || got != tt.want {
+			t.Errorf("parseBase(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "x", "1:60", "-1"} {
+		if _, err := parseBase(input); err == nil {
+			t.Errorf("parseBase(%q) should fail", input)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	s := startEngine(t)
+	s.send("frobnicate")
+	if lines := s.sync(); len(lines) != 1 || lines[0] != "Error (unknown command): frobnicate" {
+		t.Errorf("Expected an error for an unknown command, got %q", lines)
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  int
+	}{
+		{0.5, 50},
+		{-1.234, -123},
+		{999, 100001},
+		{997, 100002},
+		{-998, -100001},
+	}
+	for _, tt := range tests {
+		if got := formatScore(chess.SearchResult{Score: tt.score}); got != tt.want {
+			t.Errorf("formatScore(%v) = %d, want %d", tt.score, got, tt.want)
+		}
+	}
+}